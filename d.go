@@ -7,21 +7,294 @@ package flat
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"math"
+	"math/big"
+	"net/url"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rvflash/naming"
 
 	"gopkg.in/yaml.v3"
 )
 
+func init() {
+	// Registers the concrete types that D may hold behind its interface values to be gob encoded.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(json.Number(""))
+	gob.Register(CDATA(""))
+	gob.Register(time.Time{})
+}
+
 // Settings allows to customize the data during the marshalling or unmarshalling processes.
 type Settings func(*D)
 
+// ArraysAsJSON renders each array as a compact JSON string during the flattening process,
+// the numbers being kept as they are. It has no effect with FlattenArrays.
+// By default, arrays are kept as values.
+func ArraysAsJSON() Settings {
+	return func(d *D) {
+		d.arraysAsJSON = true
+	}
+}
+
+// EscapeKeySep doubles the separator used in the original name of a key during the flattening process,
+// in order to distinguish it from the separator added between the names of its hierarchy.
+// Combined with NoSimplify, Unflatten can then rebuild the original hierarchy of keys named in snake case.
+// The names still being converted to snake case, a camel case name like "aB" is flattened as "a_b",
+// like the key "b" of an object "a", and the leading or trailing separators of a name are dropped.
+// Such keys remain ambiguous. It has no effect with a custom KeyFunc.
+func EscapeKeySep() Settings {
+	return func(d *D) {
+		d.escapeKeySep = true
+	}
+}
+
+// FlattenArrays expands any array during the flattening process.
+// Each value of an array is lifted to the first level, using its index as suffix of its name.
+// By default, arrays are kept as values.
+func FlattenArrays() Settings {
+	return func(d *D) {
+		d.flattenArrays = true
+	}
+}
+
+// IntBase defines the base used to parse the strings as integers, as strconv.ParseInt does.
+// If base is zero, it is implied by the prefix of the string: "0x" for 16, "0o" or "0" for 8, "0b" for 2.
+// By default, the base 10 is used. Any base out of the range [2, 36] except zero is ignored.
+func IntBase(base int) Settings {
+	return func(d *D) {
+		switch {
+		case base == 0:
+			d.intBase = autoBase
+		case base >= 2 && base <= 36:
+			d.intBase = base
+		}
+	}
+}
+
+// InternStrings shares the memory of the equal strings of each document decoded by the JSON or XML unmarshalling.
+// It reduces the memory retained by the data with many repeated values, at the cost of a longer decoding.
+// By default, each string value has its own memory.
+func InternStrings() Settings {
+	return func(d *D) {
+		d.internStrings = true
+	}
+}
+
+// JSONEscapeHTML specifies whether problematic HTML characters should be escaped inside JSON quoted strings
+// by JSONEncode and JSONEncodeIndent. By default, they are escaped.
+func JSONEscapeHTML(ok bool) Settings {
+	return func(d *D) {
+		d.jsonNoEscapeHTML = !ok
+	}
+}
+
+// JSONKeepOrder records the order of the keys of each object during the JSON unmarshalling,
+// in order to restore it with JSONEncodeOrdered. By default, the order is not recorded.
+func JSONKeepOrder() Settings {
+	return func(d *D) {
+		d.jsonKeepOrder = true
+	}
+}
+
+// CaseMode defines the case of the keys returned by the flattening process.
+type CaseMode int
+
+// List of supported case modes.
+const (
+	// KeyAsIs keeps the keys as named by the flattening process.
+	KeyAsIs CaseMode = iota
+	// KeyLower converts the keys to lower case.
+	KeyLower
+	// KeyUpper converts the keys to upper case.
+	KeyUpper
+)
+
+// KeyCase defines the case of the keys returned by the flattening process. See CaseMode.
+// It applies once the keys named, prefixed and simplified, but before their truncation with MaxKeyLen.
+// By default, the keys are kept as they are.
+func KeyCase(mode CaseMode) Settings {
+	return func(d *D) {
+		d.keyCase = mode
+	}
+}
+
+// KeyCollision defines the function used to rename a flattened key which collides with an existing one,
+// because of its truncation with MaxKeyLen. It receives the name already taken and the full name of the key,
+// and it is called again while the returned name is already taken, up to 100 times before using the default.
+// By default, the taken name is shortened and suffixed by an underscore followed by 8 hexadecimal characters,
+// based on the hash of both names, the suffix being itself truncated if longer than MaxKeyLen.
+func KeyCollision(fn func(existing, candidate string) string) Settings {
+	return func(d *D) {
+		d.keyCollision = fn
+	}
+}
+
+// KeyFunc defines the function used to name each flattened key based on the names of its hierarchy.
+// By default, these names are joined using the snake case.
+func KeyFunc(fn func(parts []string) string) Settings {
+	return func(d *D) {
+		d.keyFunc = fn
+	}
+}
+
+// MaxDepth defines the maximum number of nested objects or arrays accepted by the JSON or XML unmarshalling,
+// the root object included. ErrLimitExceeded is returned as soon as the data exceeds it.
+// By default, the depth is not limited.
+func MaxDepth(n int) Settings {
+	return func(d *D) {
+		if n > 0 {
+			d.maxDepth = n
+		}
+	}
+}
+
+// MaxKeyLen defines the maximum length in bytes of a key returned by the flattening process.
+// Any longer key is truncated and renamed if its truncated name is already taken. See KeyCollision.
+// If no free name is found, the property is skipped. By default, keys are not truncated.
+func MaxKeyLen(n int) Settings {
+	return func(d *D) {
+		if n > 0 {
+			d.maxKeyLen = n
+		}
+	}
+}
+
+// MaxKeys defines the maximum number of properties accepted by the JSON or XML unmarshalling,
+// whatever their level, each value of an array counting as a property. ErrLimitExceeded is returned as soon as the data exceeds it.
+// By default, the number of properties is not limited.
+func MaxKeys(n int) Settings {
+	return func(d *D) {
+		if n > 0 {
+			d.maxKeys = n
+		}
+	}
+}
+
+// NilString defines the string rendering a nil value with FlattenStrings.
+// By default, it is an empty string.
+func NilString(s string) Settings {
+	return func(d *D) {
+		d.nilString = s
+	}
+}
+
+// NoSimplify keeps the common prefix in keys name during the flattening process.
+// By default, it is omitted to limit the length of each key.
+func NoSimplify() Settings {
+	return func(d *D) {
+		d.noSimplify = true
+	}
+}
+
+// NumberMode defines the Go type of the numbers decoded from JSON.
+type NumberMode int
+
+// List of supported number modes.
+const (
+	// NumberJSON keeps the numbers as json.Number.
+	NumberJSON NumberMode = iota
+	// NumberFloat converts the numbers to float64.
+	NumberFloat
+	// NumberAuto converts the integral numbers to int64 and the others to float64.
+	NumberAuto
+)
+
+// Numbers defines the Go type of the numbers once the JSON data decoded. See NumberMode.
+// A number out of the range of the requested type is kept as json.Number.
+// By default, numbers are decoded as json.Number.
+func Numbers(mode NumberMode) Settings {
+	return func(d *D) {
+		d.numbers = mode
+	}
+}
+
+// OmitEmpty omits the empty objects during the JSON encoding, D remaining unchanged.
+// An object only containing empty objects is then also omitted. Combined with OmitNil, the nil values are also omitted.
+func OmitEmpty() Settings {
+	return func(d *D) {
+		d.omitEmpty = true
+	}
+}
+
+// OmitNil omits the nil values from the result of the flattening process.
+// An object only containing nil values is then also omitted.
+// Combined with OmitEmpty, the JSON encoding also omits them.
+func OmitNil() Settings {
+	return func(d *D) {
+		d.omitNil = true
+	}
+}
+
+// Prefix defines a name added in front of every key returned by the flattening process,
+// as if the data were the property of an object with this name. It is never omitted as a common prefix.
+// With a KeyFunc, it is given as the first element of each path, to let the function join it,
+// and the common prefix in keys name is then kept, as with NoSimplify.
+func Prefix(p string) Settings {
+	return func(d *D) {
+		d.prefix = p
+	}
+}
+
+// Require lists the paths that must exist in D, each one being a list of keys.
+// They are checked by Validate, itself called once the JSON data decoded by UnmarshalJSON.
+func Require(paths ...[]string) Settings {
+	return func(d *D) {
+		d.required = append(d.required, paths...)
+	}
+}
+
+// Strict disables the conversion of strings into booleans or numbers by the accessors.
+// Only the native types are then accepted, any string returning an ErrOutOfRange error.
+// By default, a string like "3.14" can be read as a float64.
+func Strict() Settings {
+	return func(d *D) {
+		d.strict = true
+	}
+}
+
+// TimeLayout defines the layout used to format any time.Time value as a string,
+// during the XML encoding or by the String accessor for example. By default, DefaultTimeLayout is used.
+func TimeLayout(s string) Settings {
+	return func(d *D) {
+		if s != "" {
+			d.timeLayout = s
+		}
+	}
+}
+
+// XMLAttrPrefix enables the handling of the XML attributes of each element, except the root one.
+// During the XML unmarshalling, each attribute is stored as a property of its element,
+// named with the given prefix followed by its name. The character data of an element with attributes
+// is then stored behind the XMLTextKey property. The XML marshalling does the opposite.
+// The attribute values are typed like the character data when XMLInferTypes is used,
+// so the id of <n id="1"/> can be read with d.Int64("n", prefix+"id").
+// By default, attributes are ignored.
+func XMLAttrPrefix(s string) Settings {
+	return func(d *D) {
+		d.xmlAttrPrefix = s
+	}
+}
+
 // XMLArray defines the separator used to handle XML array.
 func XMLArray(sep string) Settings {
 	return func(d *D) {
@@ -31,6 +304,71 @@ func XMLArray(sep string) Settings {
 	}
 }
 
+// XMLSplitArrays splits any XML character data containing the array separator into an array
+// during the XML unmarshalling, as the opposite of the XML marshalling of an array.
+// It's a best-effort behavior: a string which merely contains the separator is also split.
+// By default, the character data is kept as it is.
+func XMLSplitArrays() Settings {
+	return func(d *D) {
+		d.xmlSplitArrays = true
+	}
+}
+
+// XMLInferTypes infers the type of each value during the XML unmarshalling.
+// Booleans are converted to bool, numbers to json.Number and blank values to nil.
+// It also applies to the attribute values captured with XMLAttrPrefix.
+// By default, any value is kept as a string.
+func XMLInferTypes() Settings {
+	return func(d *D) {
+		d.xmlInferTypes = true
+	}
+}
+
+// XMLTrimSpace specifies whether the character data of an element only made of whitespace is considered as blank
+// during the XML unmarshalling. Such element, without child element, is then stored as nil.
+// Otherwise, its character data is kept as it is, an empty element being stored as an empty string.
+// By default, it is considered as blank.
+func XMLTrimSpace(ok bool) Settings {
+	return func(d *D) {
+		d.xmlKeepSpace = !ok
+	}
+}
+
+// XMLTrimValues specifies whether the leading and trailing whitespace of the character data is removed
+// during the XML marshalling. CDATA sections are kept as they are. By default, the character data is not trimmed.
+func XMLTrimValues(ok bool) Settings {
+	return func(d *D) {
+		d.xmlTrimValues = ok
+	}
+}
+
+// XMLNilAttr encodes each nil value as an empty XML element with the xsi:nil="true" attribute,
+// rather than as an empty character data. The XML Schema instance namespace is then declared on the root.
+func XMLNilAttr() Settings {
+	return func(d *D) {
+		d.xmlNilAttr = true
+	}
+}
+
+// XMLArrayElement encodes each value of an array as its own XML element with the given name,
+// rather than joining them with the array separator. During the XML unmarshalling,
+// the repeated elements with this name are collected into an array. Mixed with other elements,
+// they keep their name, with an array as value if repeated.
+func XMLArrayElement(name string) Settings {
+	return func(d *D) {
+		d.xmlArrayElem = name
+	}
+}
+
+// XMLDecodeValues defines the function applied on the character data of each XML element without child,
+// during the XML unmarshalling, like url.QueryUnescape or html.UnescapeString for double-encoded values.
+// Any error returned by fn stops the unmarshalling. By default, the character data is kept as it is.
+func XMLDecodeValues(fn func(string) (string, error)) Settings {
+	return func(d *D) {
+		d.xmlDecode = fn
+	}
+}
+
 // XMLName allows to define the XML name of the data.
 func XMLName(s string) Settings {
 	return func(d *D) {
@@ -56,11 +394,27 @@ func XMLAttributes(list []xml.Attr) Settings {
 	}
 }
 
+// YAMLIndent defines the number of spaces used for indentation during the YAML encoding.
+func YAMLIndent(n int) Settings {
+	return func(d *D) {
+		if n > 0 {
+			d.yamlIndent = n
+		}
+	}
+}
+
 const (
 	// DefaultXMLName is the default XML name of the data.
 	DefaultXMLName = "d"
 	// DefaultXMLArraySep is the default XML separator of each array values.
 	DefaultXMLArraySep = "|"
+	// DefaultPathSep is the default separator of the keys in a path.
+	DefaultPathSep = "."
+	// DefaultTimeLayout is the default layout used to format a time.Time as a string.
+	DefaultTimeLayout = time.RFC3339
+	// XMLTextKey is the name of the property used to store the character data of an XML element
+	// with attributes. See XMLAttrPrefix.
+	XMLTextKey = "#text"
 )
 
 // New creates a new instance of D based on the given data and options.
@@ -83,167 +437,2507 @@ func New(m map[string]interface{}, opts ...Settings) *D {
 	return d
 }
 
-// D represents a data.
-type D struct {
-	D             map[string]interface{}
-	xmlArraySep   string
-	xmlAttributes []xml.Attr
-	xmlName       string
-	xmlns         string
-}
-
+// List of supported formats.
 const (
-	levelSep = " "
-	rootName = ""
-	keySep   = '_'
+	JSON = "json"
+	XML  = "xml"
+	YAML = "yaml"
 )
 
-// Flatten allows to export D in a single dimension.
-// Any of its properties, absent from the list of ignored keys, are lifted to the first level.
-// Each property has a new name, using the snake case, based on names of its hierarchy.
-// Common prefix in keys name are omitted to limit the length of each one.
-func (d *D) Flatten(ignoredKeys ...[]string) map[string]interface{} {
-	if len(d.D) == 0 {
-		return nil
-	}
-	not := make(map[string]struct{}, len(ignoredKeys))
-	for _, v := range ignoredKeys {
-		not[naming.SnakeCase(strings.Join(v, levelSep))] = struct{}{}
-	}
-	return simplify(flatten(d.D, not, rootName))
-}
-
-func flatten(in map[string]interface{}, not map[string]struct{}, root string) map[string]interface{} {
+// Decode creates a new instance of D based on the data read from r in the given format and the options.
+// Supported formats are JSON, XML and YAML.
+func Decode(r io.Reader, format string, opts ...Settings) (*D, error) {
 	var (
-		out = make(map[string]interface{})
-		fk  string
-		ok  bool
+		d   = New(nil, opts...)
+		err error
 	)
-	for k, v := range in {
-		fk = naming.SnakeCase(root + levelSep + k)
-		if _, ok = not[fk]; ok {
-			continue
-		}
-		switch d := v.(type) {
-		case map[string]interface{}:
-			for kf, vf := range flatten(d, not, fk) {
-				out[kf] = vf
-			}
-		default:
-			out[fk] = d
+	switch strings.ToLower(format) {
+	case JSON:
+		// Reads all the data to reject any of them after the JSON value.
+		var b []byte
+		b, err = io.ReadAll(r)
+		if err == nil {
+			err = d.UnmarshalJSON(b)
 		}
+	case XML:
+		err = xml.NewDecoder(r).Decode(d)
+	case YAML:
+		err = yaml.NewDecoder(r).Decode(d)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
 	}
-	return out
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
-func simplify(in map[string]interface{}) map[string]interface{} {
-	prefix := commonPrefix(in)
-	if prefix == "" {
-		return in
-	}
-	out := make(map[string]interface{}, len(in))
-	for k, v := range in {
-		out[strings.TrimPrefix(k, prefix)] = v
+// DecodeContext does the same as Decode, but stops reading r as soon as the context is done.
+// The error of the context is then returned.
+func DecodeContext(ctx context.Context, r io.Reader, format string, opts ...Settings) (*D, error) {
+	d, err := Decode(ctxReader{ctx: ctx, r: r}, format, opts...)
+	if err != nil && ctx.Err() != nil {
+		// Some decoders do not wrap the error of the reader.
+		return nil, ctx.Err()
 	}
-	return out
+	return d, err
 }
 
-func commonPrefix(in map[string]interface{}) string {
-	n := len(in)
-	if n <= 1 {
-		return ""
-	}
-	var (
-		i   int
-		x   = make([]string, n)
-		min = func(a, b int) int {
-			if a > b {
-				return b
-			}
-			return a
+// Convert decodes the data read from in with the format inFormat and encodes it into out with the format outFormat.
+// The options are used for both, like the naming of the XML elements. See Decode for the supported formats.
+// The JSON numbers are YAML encoded as numbers, without loss of precision.
+func Convert(in io.Reader, inFormat string, out io.Writer, outFormat string, opts ...Settings) error {
+	var enc func(*D, io.Writer) error
+	switch strings.ToLower(outFormat) {
+	case JSON:
+		enc = (*D).JSONEncode
+	case XML:
+		enc = (*D).XMLEncode
+	case YAML:
+		enc = func(d *D, w io.Writer) error {
+			yamlNumbers(d.D)
+			return d.YAMLEncode(w)
 		}
-	)
-	// Sorts keys.
-	for k := range in {
-		x[i] = k
-		i++
-	}
-	sort.Strings(x)
-	// Identifies the common prefix.
-	r1, r2 := []rune(x[0]), []rune(x[n-1])
-	c := min(len(r1), len(r2))
-	i = 0
-	for i < c && r1[i] == r2[i] {
-		i++
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, outFormat)
 	}
-	if i == 0 || r1[i-1] != keySep {
-		return ""
+	d, err := Decode(in, inFormat, opts...)
+	if err != nil {
+		return err
 	}
-	return string(r1[:i])
+	return enc(d, out)
 }
 
-// Lookup retrieves the value behind these keys.
-// If the key is present, the value behind it is returned and the boolean is true.
-func (d *D) Lookup(keys ...string) (interface{}, error) {
-	if d == nil || len(keys) == 0 {
-		return nil, ErrNotFound
+// ctxReader is a reader failing once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements the io.Reader interface.
+func (r ctxReader) Read(p []byte) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
 	}
+	return r.r.Read(p)
+}
+
+// DecodeStream creates a new instance of D for each JSON value read from r, until its end,
+// as with a stream of newline-delimited JSON objects. Each instance is created with the options
+// and decoded as with UnmarshalJSON, so its limits apply to each value.
+// On malformed data, the instances decoded so far are returned with the error.
+func DecodeStream(r io.Reader, opts ...Settings) ([]*D, error) {
 	var (
-		v  interface{} = d.D
-		m  map[string]interface{}
-		ok bool
+		dec = json.NewDecoder(r)
+		res []*D
 	)
-	for i := 0; i < len(keys); i++ {
-		m, ok = v.(map[string]interface{})
-		if !ok {
-			return nil, ErrNotFound
+	for {
+		var b json.RawMessage
+		err := dec.Decode(&b)
+		if err == io.EOF {
+			return res, nil
 		}
-		v, ok = m[keys[i]]
-		if !ok {
-			return nil, ErrNotFound
+		if err != nil {
+			return res, err
 		}
+		d := New(nil, opts...)
+		err = d.UnmarshalJSON(b)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, d)
 	}
-	return v, nil
 }
 
-// YAMLEncode YAML encodes D into w.
-func (d *D) YAMLEncode(w io.Writer) error {
-	return yaml.NewEncoder(w).Encode(d)
+// FromStruct creates a new instance of D based on the JSON encoding of v and the options.
+// The json tags of the fields are respected and numbers are stored as json.Number.
+func FromStruct(v interface{}, opts ...Settings) (*D, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := New(nil, opts...)
+	err = d.UnmarshalJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
-// MarshalYAML implements the yaml.Marshaler interface.
-func (d *D) MarshalYAML() (interface{}, error) {
-	return d.D, nil
+// NewFromFlat creates a new instance of D based on the hierarchy of the flattened map and the options.
+// Each key is split with sep to rebuild its hierarchy, as Unflatten does.
+func NewFromFlat(m map[string]interface{}, sep string, opts ...Settings) *D {
+	return New(Unflatten(m, sep), opts...)
 }
 
-// UnmarshalYAML implements the yaml.Unmarshaler interface.
-func (d *D) UnmarshalYAML(n *yaml.Node) (err error) {
-	if n == nil {
-		d.D = nil
-		return
-	}
-	return n.Decode(&d.D)
+// D represents a data.
+type D struct {
+	D                map[string]interface{}
+	arraysAsJSON     bool
+	escapeKeySep     bool
+	flattenArrays    bool
+	intBase          int
+	internStrings    bool
+	keyCase          CaseMode
+	jsonKeepOrder    bool
+	jsonNoEscapeHTML bool
+	keyOrder         map[string][]string
+	keyCollision     func(existing, candidate string) string
+	keyFunc          func(parts []string) string
+	maxDepth         int
+	maxKeyLen        int
+	maxKeys          int
+	nilString        string
+	noSimplify       bool
+	numbers          NumberMode
+	omitEmpty        bool
+	omitNil          bool
+	prefix           string
+	required         [][]string
+	strict           bool
+	timeLayout       string
+	xmlArrayElem     string
+	xmlArraySep      string
+	xmlAttrPrefix    string
+	xmlAttributes    []xml.Attr
+	xmlDecode        func(string) (string, error)
+	xmlInferTypes    bool
+	xmlKeepSpace     bool
+	xmlName          string
+	xmlNilAttr       bool
+	xmlns            string
+	xmlSplitArrays   bool
+	xmlTrimValues    bool
+	yamlIndent       int
 }
 
-// JSONEncode JSON encodes D into w.
-func (d *D) JSONEncode(w io.Writer) error {
-	return json.NewEncoder(w).Encode(d)
-}
+const (
+	rootName      = ""
+	keySep        = '_'
+	escapedKeySep = string(keySep) + string(keySep)
+)
 
-// MarshalJSON implements the json.Marshaler interface.
-func (d *D) MarshalJSON() ([]byte, error) {
-	return json.Marshal(d.D)
+// Clone returns a deep copy of D, sharing the same settings.
+func (d *D) Clone() *D {
+	if d == nil {
+		return nil
+	}
+	m, _ := deepCopy(d.D, make(refs)).(map[string]interface{})
+	return d.sub(m)
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface.
-func (d *D) UnmarshalJSON(b []byte) (err error) {
-	if b == nil {
-		d.D = nil
+// deepCopy returns a copy of v. Like Flatten, a value referencing one of its ancestors is skipped.
+func deepCopy(v interface{}, seen refs) interface{} {
+	seen.enter(v)
+	defer seen.leave(v)
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if x == nil {
+			return x
+		}
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			if seen.has(v) {
+				continue
+			}
+			m[k] = deepCopy(v, seen)
+		}
+		return m
+	case []interface{}:
+		if x == nil {
+			return x
+		}
+		a := make([]interface{}, 0, len(x))
+		for _, v := range x {
+			if seen.has(v) {
+				continue
+			}
+			a = append(a, deepCopy(v, seen))
+		}
+		return a
+	default:
+		return x
+	}
+}
+
+// Equal returns true if both data have the same properties with equal values.
+// Numbers are compared by value, whatever their type: json.Number("1") equals float64(1).
+func (d *D) Equal(other *D) bool {
+	var a, b map[string]interface{}
+	if d != nil {
+		a = d.D
+	}
+	if other != nil {
+		b = other.D
+	}
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return equal(a, b, make(refs), make(refs))
+}
+
+// Contains returns true if each leaf value of subset exists in D behind the same keys with an equal value,
+// as compared by Equal. Any other property of D is ignored. An empty subset is always contained.
+func (d *D) Contains(subset *D) bool {
+	const errMismatch = errFlat("mismatch")
+	err := subset.Walk(func(path []string, value interface{}) error {
+		v, _, err := d.lookup(path)
+		if err != nil || !equal(value, v, make(refs), make(refs)) {
+			return errMismatch
+		}
+		return nil
+	})
+	return err == nil
+}
+
+// Diff compares the flattened properties of D with those of other, both named using the settings of D.
+// Unlike Flatten, the common prefix in keys name is kept. It returns the properties only present in other,
+// those only present in D and the new values of the ones whose value has changed, as compared by Equal.
+func (d *D) Diff(other *D) (added, removed, changed map[string]interface{}) {
+	if d == nil {
+		d = &D{}
+	}
+	var (
+		a = d.flatten(make(map[string]interface{}), d.D, nil)
+		b = make(map[string]interface{})
+	)
+	if other != nil {
+		d.flatten(b, other.D, nil)
+	}
+	added = make(map[string]interface{})
+	removed = make(map[string]interface{})
+	changed = make(map[string]interface{})
+	for k, v := range a {
+		w, ok := b[k]
+		switch {
+		case !ok:
+			removed[k] = v
+		case !equal(v, w, make(refs), make(refs)):
+			changed[k] = w
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			added[k] = v
+		}
+	}
+	return added, removed, changed
+}
+
+// equal compares a and b. A value referencing one of its ancestors only equals another such value.
+func equal(a, b interface{}, seenA, seenB refs) bool {
+	okA, okB := seenA.enter(a), seenB.enter(b)
+	if !okA || !okB {
+		if okA {
+			seenA.leave(a)
+		}
+		if okB {
+			seenB.leave(b)
+		}
+		return !okA && !okB
+	}
+	defer seenA.leave(a)
+	defer seenB.leave(b)
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w, seenA, seenB) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if !equal(v, y[k], seenA, seenB) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x.Cmp(y) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Fingerprint returns the hexadecimal SHA-256 hash of the data of D, serialized in a canonical form:
+// the keys are sorted and the numbers are compared by value, whatever their type.
+// Two data equal as compared by Equal have the same fingerprint.
+func (d *D) Fingerprint() string {
+	h := sha256.New()
+	if d != nil && len(d.D) > 0 {
+		fingerprint(h, d.D, make(refs))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fingerprint(w io.Writer, v interface{}, seen refs) {
+	if !seen.enter(v) {
+		_, _ = io.WriteString(w, "~")
+		return
+	}
+	defer seen.leave(v)
+	switch x := v.(type) {
+	case map[string]interface{}:
+		_, _ = io.WriteString(w, "{")
+		for _, k := range sortedKeys(x) {
+			_, _ = io.WriteString(w, strconv.Quote(k)+":")
+			fingerprint(w, x[k], seen)
+			_, _ = io.WriteString(w, ",")
+		}
+		_, _ = io.WriteString(w, "}")
+	case []interface{}:
+		_, _ = io.WriteString(w, "[")
+		for _, v := range x {
+			fingerprint(w, v, seen)
+			_, _ = io.WriteString(w, ",")
+		}
+		_, _ = io.WriteString(w, "]")
+	case nil:
+		_, _ = io.WriteString(w, "null")
+	case bool:
+		_, _ = io.WriteString(w, strconv.FormatBool(x))
+	case string:
+		_, _ = io.WriteString(w, strconv.Quote(x))
+	case CDATA:
+		_, _ = io.WriteString(w, "c"+strconv.Quote(string(x)))
+	default:
+		n, ok := toNumber(v)
+		switch {
+		case !ok:
+			_, _ = fmt.Fprintf(w, "%T(%v)", v, v)
+		case n.Sign() == 0:
+			// Avoids to distinguish the negative zero.
+			_, _ = io.WriteString(w, "n0")
+		default:
+			// Uses the exact fraction in lowest terms, independent of the writing of the number.
+			_, _ = io.WriteString(w, "n"+n.String())
+		}
+	}
+}
+
+// Filter returns a new D, sharing the same settings, only with the properties behind the given keys.
+// Any missing key is ignored. A key targeting an object or an array keeps all its values.
+// A path going through an array, like the index of one of its values, is ignored to not change its shape.
+func (d *D) Filter(keep ...[]string) *D {
+	if d == nil {
+		return nil
+	}
+	c := d.sub(make(map[string]interface{}, len(keep)))
+	for _, keys := range keep {
+		v, ok := objectValue(d.D, keys)
+		if !ok {
+			continue
+		}
+		_ = c.Set(deepCopy(v, make(refs)), keys...)
+	}
+	return c
+}
+
+// objectValue returns the value behind the keys, only going through objects.
+func objectValue(m map[string]interface{}, keys []string) (interface{}, bool) {
+	var v interface{} = m
+	for _, k := range keys {
+		x, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = x[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, len(keys) > 0
+}
+
+// Redact replaces in place the values behind the given keys by the mask, keeping the structure intact.
+// Any missing key is ignored. A key targeting an object masks all its properties.
+// Use Clone beforehand to keep the original data unchanged.
+func (d *D) Redact(mask string, keys ...[]string) {
+	if d == nil {
+		return
+	}
+	for _, k := range keys {
+		n := len(k)
+		if n == 0 {
+			continue
+		}
+		v, _, err := d.lookup(k)
+		if err != nil {
+			continue
+		}
+		var p interface{} = d.D
+		if n > 1 {
+			p, _, _ = d.lookup(k[:n-1])
+		}
+		switch x := p.(type) {
+		case map[string]interface{}:
+			x[k[n-1]] = redact(v, mask, make(refs))
+		case []interface{}:
+			i, _ := strconv.Atoi(k[n-1])
+			x[i] = redact(v, mask, make(refs))
+		}
+	}
+}
+
+func redact(v interface{}, mask string, seen refs) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if !seen.enter(x) {
+			// Already being masked.
+			return x
+		}
+		for k, v := range x {
+			x[k] = redact(v, mask, seen)
+		}
+		seen.leave(x)
+		return x
+	default:
+		return mask
+	}
+}
+
+// Flatten allows to export D in a single dimension.
+// Any of its properties, absent from the list of ignored keys, are lifted to the first level.
+// Each property has a new name, using the snake case, based on names of its hierarchy.
+// Common prefix in keys name are omitted to limit the length of each one, unless NoSimplify is used.
+// A property referencing one of its ancestors is skipped.
+func (d *D) Flatten(ignoredKeys ...[]string) map[string]interface{} {
+	if d == nil || len(d.D) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{})
+	d.FlattenTo(out, ignoredKeys...)
+	return out
+}
+
+// FlattenTo does the same as Flatten, but stores the properties in dst, rather than in a new map.
+// Any previous content of dst is deleted, which allows to reuse it between calls.
+func (d *D) FlattenTo(dst map[string]interface{}, ignoredKeys ...[]string) {
+	for k := range dst {
+		delete(dst, k)
+	}
+	if dst == nil || d == nil || len(d.D) == 0 {
+		return
+	}
+	p := d.rootPath()
+	d.rangeFlat(d.D, d.keySet(p, ignoredKeys), rootName, p, make(refs), func(k string, v interface{}) bool {
+		dst[k] = v
+		return true
+	})
+	if d.omitNil {
+		for k, v := range dst {
+			if v == nil {
+				delete(dst, k)
+			}
+		}
+	}
+	if !d.noSimplify && len(p) == 0 {
+		simplify(dst)
+	}
+	if p := d.keyPrefix(); p != "" {
+		// Adds the prefix once simplified to not omit it.
+		rename(dst, func(k string) string {
+			return p + k
+		})
+	}
+	if d.keyCase != KeyAsIs {
+		rename(dst, d.caseKey)
+	}
+	d.shorten(dst)
+}
+
+// keyPrefix returns the prefix to add to each flattened key, with its separator. See Prefix.
+// With a KeyFunc, the prefix is part of the root path instead.
+func (d *D) keyPrefix() string {
+	if d.prefix == "" || d.keyFunc != nil {
+		return ""
+	}
+	return d.childKey(rootName, []string{d.prefix}) + string(keySep)
+}
+
+// rootPath returns the path of the data given to the KeyFunc, starting with the prefix if any. See Prefix.
+func (d *D) rootPath() []string {
+	if d.prefix == "" || d.keyFunc == nil {
+		return nil
+	}
+	return []string{d.prefix}
+}
+
+// caseKey returns the key in the case defined by the KeyCase setting.
+func (d *D) caseKey(k string) string {
+	switch d.keyCase {
+	case KeyLower:
+		return strings.ToLower(k)
+	case KeyUpper:
+		return strings.ToUpper(k)
+	default:
+		return k
+	}
+}
+
+// shorten truncates the keys longer than MaxKeyLen, in their lexical order for a deterministic result.
+// A truncated key already taken is renamed, to not overwrite any value.
+func (d *D) shorten(m map[string]interface{}) {
+	if d.maxKeyLen == 0 {
+		return
+	}
+	for _, k := range sortedKeys(m) {
+		if len(k) <= d.maxKeyLen {
+			continue
+		}
+		v := m[k]
+		delete(m, k)
+		if name, ok := d.freeName(m, k); ok {
+			m[name] = v
+		}
+	}
+}
+
+// maxResolveAttempts is the maximum number of names tried by the KeyCollision function,
+// then by the default resolver, for a key in collision.
+const maxResolveAttempts = 100
+
+// freeName returns the truncated name of the key, renamed while it is already taken in m.
+// It returns false if no free name has been found.
+func (d *D) freeName(m map[string]interface{}, k string) (string, bool) {
+	name := truncate(k, d.maxKeyLen)
+	for i := 0; i < 2*maxResolveAttempts; i++ {
+		if _, ok := m[name]; !ok {
+			return name, true
+		}
+		if d.keyCollision != nil && i < maxResolveAttempts {
+			name = d.keyCollision(name, k)
+		} else {
+			name = d.resolve(name, k)
+		}
+	}
+	return "", false
+}
+
+// resolve returns the default name of a key in collision, no longer than MaxKeyLen.
+func (d *D) resolve(existing, candidate string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(existing + candidate))
+	suffix := fmt.Sprintf("%c%08x", keySep, h.Sum32())
+	n := d.maxKeyLen - len(suffix)
+	if n < 0 {
+		return suffix[:d.maxKeyLen]
+	}
+	return truncate(existing, n) + suffix
+}
+
+// truncate returns the first n bytes of s, without splitting a multibyte character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// FlattenJSON returns the JSON encoding of the flattened D. See Flatten.
+func (d *D) FlattenJSON(ignoredKeys ...[]string) ([]byte, error) {
+	err := d.cycle()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	err = d.jsonEncoder(&buf).Encode(d.Flatten(ignoredKeys...))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// KV is a flattened property of D.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// SortedPairs returns D flattened as properties sorted by key. See Flatten.
+func (d *D) SortedPairs(ignoredKeys ...[]string) []KV {
+	m := d.Flatten(ignoredKeys...)
+	if m == nil {
+		return nil
+	}
+	out := make([]KV, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		out = append(out, KV{Key: k, Value: m[k]})
+	}
+	return out
+}
+
+// FlattenStrings returns D flattened, where each value is rendered as a string. See Flatten.
+// The values of an array are joined with the separator of the XML arrays. See XMLArray.
+// A nil value is rendered as an empty string, unless NilString is used.
+func (d *D) FlattenStrings(ignoredKeys ...[]string) map[string]string {
+	m := d.Flatten(ignoredKeys...)
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if v == nil {
+			out[k] = d.nilString
+		} else {
+			out[k] = d.fmtString(v)
+		}
+	}
+	return out
+}
+
+// EnvMap returns D flattened as environment variables: each name is the upper-cased flattened key,
+// prefixed by prefix and an underscore, and each value is rendered as a string.
+// Unlike Flatten, the common prefix in keys name is kept.
+func (d *D) EnvMap(prefix string) map[string]string {
+	if d == nil || len(d.D) == 0 {
+		return nil
+	}
+	prefix = strings.TrimSuffix(prefix, string(keySep))
+	if prefix != "" {
+		prefix += string(keySep)
+	}
+	var (
+		m   = d.flatten(make(map[string]interface{}), d.D, nil)
+		out = make(map[string]string, len(m))
+	)
+	for k, v := range m {
+		out[strings.ToUpper(prefix+k)] = d.fmtString(v)
+	}
+	return out
+}
+
+// URLValues returns D flattened as url.Values, where each value is rendered as a string.
+// Rather than being joined, each value of an array is added under the same key.
+func (d *D) URLValues(ignoredKeys ...[]string) url.Values {
+	m := d.Flatten(ignoredKeys...)
+	if m == nil {
+		return nil
+	}
+	out := make(url.Values, len(m))
+	for k, v := range m {
+		a, ok := v.([]interface{})
+		if !ok {
+			out.Add(k, d.fmtString(v))
+			continue
+		}
+		for _, v2 := range a {
+			out.Add(k, d.fmtString(v2))
+		}
+	}
+	return out
+}
+
+// Rename returns D flattened, where each key found in the mapping is renamed with its target name.
+// Unlike Flatten, the common prefix in keys name is kept, and the other keys are kept as they are.
+// The mapping names each property by the names of its hierarchy, in snake case, joined with sep.
+// If sep is empty, the underscore is used. ErrConflict is returned if several keys have the same name once renamed.
+func (d *D) Rename(mapping map[string]string, sep string) (map[string]interface{}, error) {
+	if d == nil || len(d.D) == 0 {
+		return nil, nil
+	}
+	if sep == "" {
+		sep = string(keySep)
+	}
+	var (
+		c     = d.sub(d.D)
+		paths = make(map[string][]string)
+	)
+	// Names each property by its JSON pointer to retrieve the names of its hierarchy.
+	c.keyFunc = func(parts []string) string {
+		k := pointer(parts)
+		paths[k] = parts
+		return k
+	}
+	var (
+		m   = c.flatten(make(map[string]interface{}), c.D, nil)
+		out = make(map[string]interface{}, len(m))
+	)
+	for _, k := range sortedKeys(m) {
+		var (
+			parts = paths[k]
+			names = make([]string, len(parts))
+		)
+		for i, v := range parts {
+			names[i] = naming.SnakeCase(v)
+		}
+		name, ok := mapping[strings.Join(names, sep)]
+		if !ok {
+			name = d.keyName(parts)
+		}
+		if _, ok = out[name]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrConflict, name)
+		}
+		out[name] = m[k]
+	}
+	return out, nil
+}
+
+// ConflictPolicy defines how to resolve a key present in several maps to merge.
+type ConflictPolicy int
+
+// List of supported conflict policies.
+const (
+	// ConflictFirst keeps the value of the first map with the key.
+	ConflictFirst ConflictPolicy = iota
+	// ConflictLast keeps the value of the last map with the key.
+	ConflictLast
+	// ConflictError returns ErrConflict.
+	ConflictError
+)
+
+// MergeFlat merges the maps, typically returned by Flatten, into a new one.
+// A key present in several maps is resolved by the policy. See ConflictPolicy.
+func MergeFlat(policy ConflictPolicy, maps ...map[string]interface{}) (map[string]interface{}, error) {
+	var n int
+	for _, m := range maps {
+		n += len(m)
+	}
+	out := make(map[string]interface{}, n)
+	for _, m := range maps {
+		for _, k := range sortedKeys(m) {
+			if _, ok := out[k]; ok {
+				switch policy {
+				case ConflictFirst:
+					continue
+				case ConflictError:
+					return nil, fmt.Errorf("%w: %q", ErrConflict, k)
+				}
+			}
+			out[k] = m[k]
+		}
+	}
+	return out, nil
+}
+
+// Unflatten does the opposite of Flatten, by splitting each key of the map with sep to build its hierarchy.
+// A doubled separator is considered as part of the name of the key. See EscapeKeySep.
+// If sep is empty, the underscore is used. When a key is both a value and the parent of other keys,
+// the object of these other keys is kept.
+func Unflatten(m map[string]interface{}, sep string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	if sep == "" {
+		sep = string(keySep)
+	}
+	out := make(map[string]interface{}, len(m))
+	for _, k := range sortedKeys(m) {
+		var (
+			a = splitKey(k, sep)
+			n = len(a) - 1
+			p = out
+		)
+		for _, v := range a[:n] {
+			c, _ := p[v].(map[string]interface{})
+			if c == nil {
+				c = make(map[string]interface{})
+				p[v] = c
+			}
+			p = c
+		}
+		if _, ok := p[a[n]].(map[string]interface{}); !ok {
+			p[a[n]] = m[k]
+		}
+	}
+	return out
+}
+
+// splitKey slices s into all substrings separated by sep, except for a doubled separator which is kept as sep.
+func splitKey(s, sep string) []string {
+	var (
+		a   []string
+		buf strings.Builder
+		n   = len(sep)
+	)
+	if n == 0 {
+		return []string{s}
+	}
+	for {
+		i := strings.Index(s, sep)
+		if i < 0 {
+			buf.WriteString(s)
+			return append(a, buf.String())
+		}
+		buf.WriteString(s[:i])
+		s = s[i+n:]
+		if strings.HasPrefix(s, sep) {
+			buf.WriteString(sep)
+			s = s[n:]
+			continue
+		}
+		a = append(a, buf.String())
+		buf.Reset()
+	}
+}
+
+// Validate checks that a value, even null, exists behind each of the paths required with Require.
+// An error listing the missing paths, each of its keys being joined with DefaultPathSep, is returned otherwise.
+func (d *D) Validate() error {
+	if d == nil {
+		return nil
+	}
+	var missing []string
+	for _, keys := range d.required {
+		if !d.Has(keys...) {
+			missing = append(missing, strings.Join(keys, DefaultPathSep))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrMissingRequired, strings.Join(missing, ", "))
+}
+
+// ValidateNoUnknown checks that each property of D is part of the list of allowed keys.
+// An allowed key also allows all the properties under it.
+// An error listing the flattened names of the unknown properties is returned otherwise.
+func (d *D) ValidateNoUnknown(allowed ...[]string) error {
+	if d == nil || len(d.D) == 0 {
+		return nil
+	}
+	out := d.flatten(make(map[string]interface{}), d.D, d.keySet(nil, allowed))
+	if len(out) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownKey, strings.Join(sortedKeys(out), ", "))
+}
+
+func (d *D) keySet(root []string, list [][]string) map[string]struct{} {
+	m := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		m[d.keyName(append(root[:len(root):len(root)], v...))] = struct{}{}
+	}
+	return m
+}
+
+// keyName returns the name of the flattened key based on the names of its hierarchy.
+func (d *D) keyName(parts []string) string {
+	var k string
+	for i := range parts {
+		k = d.childKey(k, parts[:i+1])
+	}
+	return k
+}
+
+// childKey returns the name of the flattened key of the last element of the path, based on the name of its parent.
+func (d *D) childKey(root string, path []string) string {
+	switch {
+	case d.keyFunc != nil:
+		return d.keyFunc(path)
+	case d.escapeKeySep:
+		k := escapeKey(path[len(path)-1])
+		if root == rootName {
+			return k
+		}
+		return root + string(keySep) + k
+	default:
+		// The name of the parent being already in snake case, only the new element is converted.
+		k := naming.SnakeCase(path[len(path)-1])
+		switch {
+		case root == rootName:
+			return k
+		case k == "":
+			return root
+		default:
+			return root + string(keySep) + k
+		}
+	}
+}
+
+// escapeKey returns the key using the snake case, where each of its original separators is doubled.
+// The separators added by the snake case, as those leading or trailing, are not escaped.
+func escapeKey(k string) string {
+	var (
+		a = strings.Split(k, string(keySep))
+		b = a[:0]
+	)
+	for _, v := range a {
+		if v = naming.SnakeCase(v); v != "" {
+			b = append(b, v)
+		}
+	}
+	return strings.Join(b, escapedKeySep)
+}
+
+func (d *D) flatten(out, in map[string]interface{}, not map[string]struct{}) map[string]interface{} {
+	d.rangeFlat(in, not, rootName, nil, make(refs), func(k string, v interface{}) bool {
+		out[k] = v
+		return true
+	})
+	return out
+}
+
+// Range calls fn sequentially for each property of D that the flattening process would return,
+// with the exception of the ignored keys. The OmitNil, Prefix and KeyCase settings apply but, unlike Flatten,
+// common prefix in keys name are kept and the keys are not truncated with MaxKeyLen.
+// If fn returns false, Range stops the iteration.
+func (d *D) Range(fn func(key string, value interface{}) bool, ignoredKeys ...[]string) {
+	if d == nil || fn == nil {
+		return
+	}
+	var (
+		p    = d.keyPrefix()
+		root = d.rootPath()
+	)
+	d.rangeFlat(d.D, d.keySet(root, ignoredKeys), rootName, root, make(refs), func(k string, v interface{}) bool {
+		if v == nil && d.omitNil {
+			return true
+		}
+		return fn(d.caseKey(p+k), v)
+	})
+}
+
+// rangeFlat skips any value referencing one of its ancestors to avoid an endless recursion.
+func (d *D) rangeFlat(
+	in map[string]interface{},
+	not map[string]struct{},
+	root string,
+	path []string,
+	seen refs,
+	fn func(string, interface{}) bool,
+) bool {
+	if !seen.enter(in) {
+		return true
+	}
+	defer seen.leave(in)
+	var (
+		fk string
+		fp []string
+		ok bool
+	)
+	if d.keyFunc == nil {
+		// Shares the path between siblings to limit the allocations, only its last element being used.
+		fp = append(path, "")
+	}
+	for k, v := range in {
+		if d.keyFunc != nil {
+			// Forces a copy of the path to not share it between siblings, as it's exposed.
+			fp = append(path[:len(path):len(path)], k)
+		} else {
+			fp[len(path)] = k
+		}
+		fk = d.childKey(root, fp)
+		if _, ok = not[fk]; ok {
+			continue
+		}
+		switch x := v.(type) {
+		case map[string]interface{}:
+			ok = d.rangeFlat(x, not, fk, fp, seen, fn)
+		case []interface{}:
+			if !d.flattenArrays {
+				ok = fn(fk, d.jsonArray(x))
+				break
+			}
+			if !seen.enter(x) {
+				continue
+			}
+			ok = d.rangeFlat(indexed(x), not, fk, fp, seen, fn)
+			seen.leave(x)
+		default:
+			ok = fn(fk, x)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonArray returns the array as a JSON string if the ArraysAsJSON setting is enabled.
+// Otherwise, or if it can not be encoded, the array is returned as it is.
+func (d *D) jsonArray(a []interface{}) interface{} {
+	if !d.arraysAsJSON {
+		return a
+	}
+	var buf bytes.Buffer
+	err := d.jsonEncoder(&buf).Encode(a)
+	if err != nil {
+		return a
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Walk traverses D depth-first, in the lexical order of the keys, and calls fn for each leaf value
+// with the raw segments of its path. Unlike Range, the path is neither joined nor converted to snake case.
+// Arrays are leaves, unless the FlattenArrays setting is enabled: the index of each element is then a segment.
+// Walk stops at the first error returned by fn and returns it, or ErrCycle if D references itself.
+func (d *D) Walk(fn func(path []string, value interface{}) error) error {
+	if d == nil || fn == nil {
+		return nil
+	}
+	err := d.cycle()
+	if err != nil {
+		return err
+	}
+	return d.walk(d.D, nil, fn)
+}
+
+func (d *D) walk(in map[string]interface{}, path []string, fn func([]string, interface{}) error) error {
+	var err error
+	for _, k := range sortedKeys(in) {
+		// Forces a copy of the path to not share it between siblings.
+		fp := append(path[:len(path):len(path)], k)
+		switch x := in[k].(type) {
+		case map[string]interface{}:
+			err = d.walk(x, fp, fn)
+		case []interface{}:
+			if d.flattenArrays {
+				err = d.walkArray(x, fp, fn)
+			} else {
+				err = fn(fp, x)
+			}
+		default:
+			err = fn(fp, x)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *D) walkArray(a []interface{}, path []string, fn func([]string, interface{}) error) error {
+	var err error
+	for i, v := range a {
+		fp := append(path[:len(path):len(path)], strconv.Itoa(i))
+		switch x := v.(type) {
+		case map[string]interface{}:
+			err = d.walk(x, fp, fn)
+		case []interface{}:
+			err = d.walkArray(x, fp, fn)
+		default:
+			err = fn(fp, x)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refs lists the maps and arrays being traversed, identified by their address.
+type refs map[uintptr]struct{}
+
+// enter marks v as being traversed. It returns false if v already is, meaning that v references itself.
+func (r refs) enter(v interface{}) bool {
+	p := ref(v)
+	if p == 0 {
+		return true
+	}
+	if _, ok := r[p]; ok {
+		return false
+	}
+	r[p] = struct{}{}
+	return true
+}
+
+// has returns true if v is being traversed.
+func (r refs) has(v interface{}) bool {
+	p := ref(v)
+	if p == 0 {
+		return false
+	}
+	_, ok := r[p]
+	return ok
+}
+
+// leave marks v as traversed.
+func (r refs) leave(v interface{}) {
+	delete(r, ref(v))
+}
+
+// ref returns the address of the map or array, or zero for any other value.
+func ref(v interface{}) uintptr {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return reflect.ValueOf(x).Pointer()
+	case []interface{}:
+		// Empty arrays can share the same address.
+		if len(x) > 0 {
+			return reflect.ValueOf(x).Pointer()
+		}
+	}
+	return 0
+}
+
+// cycle returns ErrCycle if the data contains a map or an array referencing itself.
+func (d *D) cycle() error {
+	if d == nil {
+		return nil
+	}
+	return cycle(d.D, make(refs))
+}
+
+func cycle(v interface{}, seen refs) error {
+	var err error
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if !seen.enter(x) {
+			return ErrCycle
+		}
+		for _, w := range x {
+			if err = cycle(w, seen); err != nil {
+				return err
+			}
+		}
+		seen.leave(x)
+	case []interface{}:
+		if !seen.enter(x) {
+			return ErrCycle
+		}
+		for _, w := range x {
+			if err = cycle(w, seen); err != nil {
+				return err
+			}
+		}
+		seen.leave(x)
+	}
+	return nil
+}
+
+// indexed returns the values of the slice as a map where each key is the index of the value.
+func indexed(a []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		m[strconv.Itoa(k)] = v
+	}
+	return m
+}
+
+func simplify(in map[string]interface{}) map[string]interface{} {
+	prefix := commonPrefix(in)
+	if prefix == "" {
+		return in
+	}
+	return rename(in, func(k string) string {
+		return strings.TrimPrefix(k, prefix)
+	})
+}
+
+// rename renames in place each key of the map with fn.
+// All the keys are removed before, to not overwrite a key not yet renamed.
+func rename(in map[string]interface{}, fn func(string) string) map[string]interface{} {
+	var (
+		keys = sortedKeys(in)
+		vals = make([]interface{}, len(keys))
+	)
+	for k, v := range keys {
+		vals[k] = in[v]
+		delete(in, v)
+	}
+	for k, v := range keys {
+		in[fn(v)] = vals[k]
+	}
+	return in
+}
+
+func commonPrefix(in map[string]interface{}) string {
+	n := len(in)
+	if n <= 1 {
+		return ""
+	}
+	var (
+		i   int
+		x   = sortedKeys(in)
+		min = func(a, b int) int {
+			if a > b {
+				return b
+			}
+			return a
+		}
+	)
+	// Identifies the common prefix.
+	r1, r2 := []rune(x[0]), []rune(x[n-1])
+	c := min(len(r1), len(r2))
+	for i < c && r1[i] == r2[i] {
+		i++
+	}
+	if i == 0 || r1[i-1] != keySep {
+		return ""
+	}
+	return string(r1[:i])
+}
+
+func sortedKeys(in map[string]interface{}) []string {
+	var (
+		i int
+		x = make([]string, len(in))
+	)
+	for k := range in {
+		x[i] = k
+		i++
+	}
+	sort.Strings(x)
+	return x
+}
+
+// Keys returns the sorted list of the keys on the first level of D.
+func (d *D) Keys() []string {
+	if d == nil {
+		return []string{}
+	}
+	return sortedKeys(d.D)
+}
+
+// Len returns the number of properties on the first level of D.
+func (d *D) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.D)
+}
+
+// DeepLen returns the number of properties that the flattening of D would produce,
+// before omitting any of them.
+func (d *D) DeepLen() int {
+	if d == nil {
+		return 0
+	}
+	return d.deepLen(d.D, make(refs))
+}
+
+func (d *D) deepLen(v interface{}, seen refs) int {
+	var n int
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if !seen.enter(x) {
+			return 0
+		}
+		for _, v := range x {
+			n += d.deepLen(v, seen)
+		}
+		seen.leave(x)
+	case []interface{}:
+		if !d.flattenArrays {
+			return 1
+		}
+		if !seen.enter(x) {
+			return 0
+		}
+		for _, v := range x {
+			n += d.deepLen(v, seen)
+		}
+		seen.leave(x)
+	default:
+		return 1
+	}
+	return n
+}
+
+// TypeCounts returns the number of values of D by type: "string", "number", "bool", "null", "array" or "object".
+// Any other type is counted as "other". Like Flatten, the elements of an array are only counted
+// with the FlattenArrays setting, and a value referencing one of its ancestors is skipped.
+func (d *D) TypeCounts() map[string]int {
+	out := make(map[string]int)
+	if d == nil {
+		return out
+	}
+	seen := make(refs)
+	seen.enter(d.D)
+	for _, v := range d.D {
+		d.typeCounts(v, out, seen)
+	}
+	return out
+}
+
+func (d *D) typeCounts(v interface{}, out map[string]int, seen refs) {
+	var a []interface{}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		out["object"]++
+		for _, w := range x {
+			a = append(a, w)
+		}
+	case []interface{}:
+		out["array"]++
+		if d.flattenArrays {
+			a = x
+		}
+	case nil:
+		out["null"]++
+	case bool:
+		out["bool"]++
+	case string, CDATA:
+		out["string"]++
+	default:
+		if _, ok := toNumber(v); ok {
+			out["number"]++
+		} else {
+			out["other"]++
+		}
+	}
+	if len(a) == 0 || !seen.enter(v) {
+		return
+	}
+	for _, w := range a {
+		d.typeCounts(w, out, seen)
+	}
+	seen.leave(v)
+}
+
+// Lookup retrieves the value behind these keys.
+// If the key is present, the value behind it is returned, otherwise an error.
+// A numeric key can be used as index to retrieve a value inside an array.
+// The error mentions the path up to the key in failure.
+func (d *D) Lookup(keys ...string) (interface{}, error) {
+	v, i, err := d.lookup(keys)
+	if err != nil && i >= 0 {
+		return nil, fmt.Errorf("%w: %q", err, strings.Join(keys[:i+1], DefaultPathSep))
+	}
+	return v, err
+}
+
+// LookupMany retrieves the values behind each of these paths, in the same order.
+// It stops on the first path in failure, the error mentioning this path in full.
+func (d *D) LookupMany(paths ...[]string) ([]interface{}, error) {
+	out := make([]interface{}, len(paths))
+	for k, keys := range paths {
+		v, _, err := d.lookup(keys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, strings.Join(keys, DefaultPathSep))
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// Path is a list of keys, usable with any accessor: d.Bool(flat.P("object", "enabled")...).
+type Path []string
+
+// P returns a new Path made of these keys.
+func P(keys ...string) Path {
+	return append(Path(nil), keys...)
+}
+
+// Add returns a copy of the Path with the key added at its end.
+func (p Path) Add(key string) Path {
+	return append(p[:len(p):len(p)], key)
+}
+
+// LookupPath retrieves the value behind the path, each of its keys being separated by sep.
+// If sep is empty, the dot is used as separator.
+func (d *D) LookupPath(path, sep string) (interface{}, error) {
+	if path == "" {
+		return nil, ErrNotFound
+	}
+	if sep == "" {
+		sep = DefaultPathSep
+	}
+	return d.Lookup(strings.Split(path, sep)...)
+}
+
+// LookupPointer retrieves the value behind the JSON pointer, as defined by the RFC 6901.
+// Each key is prefixed by a slash, the "~1" and "~0" sequences being respectively decoded as "/" and "~".
+// The empty pointer refers to the whole document.
+func (d *D) LookupPointer(ptr string) (interface{}, error) {
+	keys, err := pointerKeys(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrNotFound
+	}
+	v, err := pointed(d.D, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, ptr)
+	}
+	return v, nil
+}
+
+// pointerKeys returns the keys of the JSON pointer, or nil if it refers to the whole document.
+func pointerKeys(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPointer, ptr)
+	}
+	keys := strings.Split(ptr[1:], "/")
+	for k, v := range keys {
+		if strings.Count(v, "~") != strings.Count(v, "~0")+strings.Count(v, "~1") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPointer, ptr)
+		}
+		keys[k] = pointerReplacer.Replace(v)
+	}
+	return keys, nil
+}
+
+var pointerReplacer = strings.NewReplacer("~1", "/", "~0", "~")
+
+// pointer returns the JSON pointer of these keys, the reverse of pointerKeys.
+func pointer(keys []string) string {
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteByte('/')
+		buf.WriteString(pointerEscaper.Replace(k))
+	}
+	return buf.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Has returns true if a value, even null, exists behind these keys.
+func (d *D) Has(keys ...string) bool {
+	_, _, err := d.lookup(keys)
+	return err == nil
+}
+
+// Get returns the value behind these keys and true if it exists, even null, otherwise false.
+// Unlike Lookup, the cause of a failure is not built, which is cheaper when it does not matter.
+func (d *D) Get(keys ...string) (interface{}, bool) {
+	v, _, err := d.lookup(keys)
+	return v, err == nil
+}
+
+// lookup retrieves the value behind these keys.
+// On failure, it also returns the index of the key in error, or -1 if the error does not concern a key.
+func (d *D) lookup(keys []string) (interface{}, int, error) {
+	if d == nil || len(keys) == 0 {
+		return nil, -1, ErrNotFound
+	}
+	var (
+		v   interface{} = d.D
+		ok  bool
+		err error
+	)
+	for i := 0; i < len(keys); i++ {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			v, ok = x[keys[i]]
+			if !ok {
+				return nil, i, ErrNotFound
+			}
+		case []interface{}:
+			v, err = index(x, keys[i])
+			if err != nil {
+				return nil, i, err
+			}
+		default:
+			if _, err = strconv.Atoi(keys[i]); err == nil {
+				return nil, i, newErrOutOfRange([]interface{}(nil), v)
+			}
+			return nil, i, ErrNotFound
+		}
+	}
+	return v, -1, nil
+}
+
+// index returns the value of the array behind the index i, given as a string.
+func index(a []interface{}, i string) (interface{}, error) {
+	k, err := strconv.Atoi(i)
+	if err != nil || k < 0 || k >= len(a) {
+		return nil, ErrNotFound
+	}
+	return a[k], nil
+}
+
+// Normalize converts in place any number of D, whatever its Go type, as a json.Number,
+// like those decoded by UnmarshalJSON. Floating-point numbers are formatted without exponent,
+// NaN and infinite ones, not representable in JSON, being kept as they are.
+// Hence, all the accessors behave identically, whatever the origin of the data.
+func (d *D) Normalize() {
+	if d == nil {
+		return
+	}
+	normalize(d.D, make(refs))
+}
+
+func normalize(v interface{}, seen refs) interface{} {
+	if !seen.enter(v) {
+		// Already being normalized.
+		return v
+	}
+	defer seen.leave(v)
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, v := range x {
+			x[k] = normalize(v, seen)
+		}
+		return x
+	case []interface{}:
+		for k, v := range x {
+			x[k] = normalize(v, seen)
+		}
+		return x
+	case float32:
+		if !isFinite(float64(x)) {
+			return x
+		}
+		return json.Number(strconv.FormatFloat(float64(x), 'f', precision, bits32))
+	case float64:
+		if !isFinite(x) {
+			return x
+		}
+		return json.Number(strconv.FormatFloat(x, 'f', precision, bits64))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return json.Number(fmtString(x, "", DefaultTimeLayout))
+	default:
+		return x
+	}
+}
+
+// isFinite reports whether f is neither NaN nor infinite.
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// Set stores the value behind these keys.
+// Any missing intermediate key is created as an object.
+// An error is returned if one of them already exists but is not an object.
+func (d *D) Set(value interface{}, keys ...string) error {
+	if d == nil || len(keys) == 0 {
+		return ErrNotFound
+	}
+	if d.D == nil {
+		d.D = make(map[string]interface{})
+	}
+	var (
+		m  = d.D
+		v  interface{}
+		ok bool
+	)
+	for i := 0; i < len(keys)-1; i++ {
+		v, ok = m[keys[i]]
+		if !ok {
+			v = make(map[string]interface{})
+			m[keys[i]] = v
+		}
+		m, ok = v.(map[string]interface{})
+		if !ok {
+			return newErrOutOfRange(m, v)
+		}
+	}
+	m[keys[len(keys)-1]] = value
+	return nil
+}
+
+// List of supported JSON patch operations.
+const (
+	patchAdd     = "add"
+	patchCopy    = "copy"
+	patchMove    = "move"
+	patchRemove  = "remove"
+	patchReplace = "replace"
+	patchTest    = "test"
+)
+
+// patchOp is an operation of a JSON patch.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyPatch applies the JSON patch to D, as defined by the RFC 6902: a JSON array of operations among
+// "add", "remove", "replace", "move", "copy" and "test", each one targeting a JSON pointer whose array indexes
+// are strictly parsed, whatever the operation. See LookupPointer.
+// The operations are applied in sequence and D remains unchanged if any of them fails.
+// ErrTestFailed is returned if the value tested differs, as compared by Equal,
+// and ErrCycle if the data contains a reference to itself.
+func (d *D) ApplyPatch(ops []byte) error {
+	if d == nil {
+		return ErrNotFound
+	}
+	var list []patchOp
+	err := json.Unmarshal(ops, &list)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+	err = d.cycle()
+	if err != nil {
+		return err
+	}
+	doc, _ := deepCopy(d.D, make(refs)).(map[string]interface{})
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for k, op := range list {
+		doc, err = d.patch(doc, op)
+		if err != nil {
+			return fmt.Errorf("%w: operation %d", err, k)
+		}
+	}
+	d.D = doc
+	return nil
+}
+
+// patch returns the document once the operation applied.
+func (d *D) patch(doc map[string]interface{}, op patchOp) (map[string]interface{}, error) {
+	path, err := pointerKeys(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case patchAdd, patchReplace, patchTest:
+		value, err = d.patchValue(op.Value)
+	case patchCopy, patchMove:
+		var from []string
+		from, err = pointerKeys(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err = pointed(doc, from)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, op.From)
+		}
+		if op.Op == patchCopy {
+			value = deepCopy(value, make(refs))
+			break
+		}
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, fmt.Errorf("%w: %q moved into one of its children", ErrInvalidPatch, op.From)
+		}
+		doc, err = patchRoot(doc, from, patchRemoved)
+	case patchRemove:
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case patchRemove:
+		doc, err = patchRoot(doc, path, patchRemoved)
+	case patchReplace:
+		doc, err = patchRoot(doc, path, patchReplaced(value))
+	case patchTest:
+		var v interface{}
+		if v, err = pointed(doc, path); err == nil && !equal(v, value, make(refs), make(refs)) {
+			err = ErrTestFailed
+		}
+	default:
+		doc, err = patchRoot(doc, path, patchAdded(value))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, op.Path)
+	}
+	return doc, nil
+}
+
+// patchValue returns the value of an operation, its numbers being converted as defined by the Numbers setting.
+func (d *D) patchValue(b json.RawMessage) (interface{}, error) {
+	if b == nil {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+	if n, ok := v.(json.Number); ok && d.numbers != NumberJSON {
+		return d.convertNumber(n), nil
+	}
+	d.convertNumbers(v)
+	return v, nil
+}
+
+// pointed returns the value behind the keys of the document, the document itself without key.
+// Unlike Lookup, the index of an array is strictly parsed, as defined by the RFC 6901.
+func pointed(doc map[string]interface{}, keys []string) (interface{}, error) {
+	var v interface{} = doc
+	for _, k := range keys {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			w, ok := x[k]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			v = w
+		case []interface{}:
+			i, err := arrayIndex(k, len(x)-1)
+			if err != nil {
+				return nil, err
+			}
+			v = x[i]
+		default:
+			return nil, ErrNotFound
+		}
+	}
+	return v, nil
+}
+
+// patchRoot applies fn on the value behind the keys of the document. Without key, the document is replaced.
+func patchRoot(
+	doc map[string]interface{}, keys []string, fn func(interface{}, string) (interface{}, error),
+) (map[string]interface{}, error) {
+	if keys == nil {
+		// Uses a parent to handle the document as any other value.
+		p := map[string]interface{}{"": doc}
+		_, err := fn(p, "")
+		if err != nil {
+			return nil, err
+		}
+		m, ok := p[""].(map[string]interface{})
+		if !ok && p[""] != nil {
+			return nil, newErrOutOfRange(m, p[""])
+		}
+		if m == nil {
+			m = make(map[string]interface{})
+		}
+		return m, nil
+	}
+	_, err := patchAt(doc, keys, fn)
+	return doc, err
+}
+
+// patchAt applies fn on the container of the last key and returns the container of the first one,
+// which has to be stored again when it is an array.
+func patchAt(v interface{}, keys []string, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(keys) == 1 {
+		return fn(v, keys[0])
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		c, ok := x[keys[0]]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		c, err := patchAt(c, keys[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		x[keys[0]] = c
+		return x, nil
+	case []interface{}:
+		i, err := arrayIndex(keys[0], len(x)-1)
+		if err != nil {
+			return nil, err
+		}
+		c, err := patchAt(x[i], keys[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		x[i] = c
+		return x, nil
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+// arrayIndex returns the index of an array behind the key, as defined by the RFC 6901, if it's less or equal to max.
+func arrayIndex(key string, max int) (int, error) {
+	if key == "" || (len(key) > 1 && key[0] == '0') || strings.Trim(key, "0123456789") != "" {
+		return 0, ErrNotFound
+	}
+	i, err := strconv.Atoi(key)
+	if err != nil || i > max {
+		return 0, ErrNotFound
+	}
+	return i, nil
+}
+
+// patchAdded returns the function adding the value to the container. The key "-" appends it to an array.
+func patchAdded(value interface{}) func(interface{}, string) (interface{}, error) {
+	return func(v interface{}, key string) (interface{}, error) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			x[key] = value
+			return x, nil
+		case []interface{}:
+			if key == "-" {
+				return append(x, value), nil
+			}
+			i, err := arrayIndex(key, len(x))
+			if err != nil {
+				return nil, err
+			}
+			x = append(x, nil)
+			copy(x[i+1:], x[i:])
+			x[i] = value
+			return x, nil
+		default:
+			return nil, ErrNotFound
+		}
+	}
+}
+
+// patchReplaced returns the function replacing the existing value of the container.
+func patchReplaced(value interface{}) func(interface{}, string) (interface{}, error) {
+	return func(v interface{}, key string) (interface{}, error) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if _, ok := x[key]; !ok {
+				return nil, ErrNotFound
+			}
+			x[key] = value
+			return x, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(x)-1)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = value
+			return x, nil
+		default:
+			return nil, ErrNotFound
+		}
+	}
+}
+
+// patchRemoved removes the existing value of the container.
+func patchRemoved(v interface{}, key string) (interface{}, error) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if _, ok := x[key]; !ok {
+			return nil, ErrNotFound
+		}
+		delete(x, key)
+		return x, nil
+	case []interface{}:
+		i, err := arrayIndex(key, len(x)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(x[:i], x[i+1:]...), nil
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+// yamlNumber is a JSON number to YAML encode as a number rather than as a string.
+type yamlNumber json.Number
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (n yamlNumber) MarshalYAML() (interface{}, error) {
+	tag := "!!float"
+	if isIntegral(json.Number(n)) {
+		tag = "!!int"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(n)}, nil
+}
+
+// yamlNumbers replaces in place the json.Number of v by a yamlNumber.
+func yamlNumbers(v interface{}) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, w := range x {
+			if n, ok := w.(json.Number); ok {
+				x[k] = yamlNumber(n)
+				continue
+			}
+			yamlNumbers(w)
+		}
+	case []interface{}:
+		for k, w := range x {
+			if n, ok := w.(json.Number); ok {
+				x[k] = yamlNumber(n)
+				continue
+			}
+			yamlNumbers(w)
+		}
+	}
+}
+
+// YAMLEncode YAML encodes D into w.
+func (d *D) YAMLEncode(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	if d != nil && d.yamlIndent > 0 {
+		enc.SetIndent(d.yamlIndent)
+	}
+	return enc.Encode(d)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (d *D) MarshalYAML() (interface{}, error) {
+	if d == nil {
+		return nil, nil
+	}
+	err := d.cycle()
+	if err != nil {
+		return nil, err
+	}
+	return d.D, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *D) UnmarshalYAML(n *yaml.Node) (err error) {
+	if d == nil {
+		return ErrInvalidTarget
+	}
+	if n == nil {
+		d.D = nil
+		return
+	}
+	return n.Decode(&d.D)
+}
+
+// JSONSchema returns a minimal JSON Schema describing D, with the type of each property inferred from its value.
+// The items of an array are described when all of them have the same type.
+// Nil is returned if D is empty or references itself.
+func (d *D) JSONSchema() map[string]interface{} {
+	if d == nil || len(d.D) == 0 || d.cycle() != nil {
+		return nil
+	}
+	return jsonSchema(d.D)
+}
+
+func jsonSchema(v interface{}) map[string]interface{} {
+	switch x := v.(type) {
+	case nil:
+		return map[string]interface{}{"type": "null"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case string, CDATA:
+		return map[string]interface{}{"type": "string"}
+	case map[string]interface{}:
+		props := make(map[string]interface{}, len(x))
+		for k, w := range x {
+			props[k] = jsonSchema(w)
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	case []interface{}:
+		m := map[string]interface{}{"type": "array"}
+		if items := jsonSchemaItems(x); items != nil {
+			m["items"] = items
+		}
+		return m
+	}
+	if _, ok := toNumber(v); ok {
+		return map[string]interface{}{"type": "number"}
+	}
+	// Unknown type: any value is allowed.
+	return map[string]interface{}{}
+}
+
+// jsonSchemaItems returns the schema of the items of the array if all of them have the same type, nil otherwise.
+func jsonSchemaItems(a []interface{}) map[string]interface{} {
+	if len(a) == 0 {
+		return nil
+	}
+	items := jsonSchema(a[0])
+	for _, v := range a[1:] {
+		if !reflect.DeepEqual(items["type"], jsonSchema(v)["type"]) {
+			return nil
+		}
+	}
+	return items
+}
+
+// JSONEncode JSON encodes D into w.
+func (d *D) JSONEncode(w io.Writer) error {
+	err := d.cycle()
+	if err != nil {
+		return err
+	}
+	return d.jsonEncoder(w).Encode(d.jsonData())
+}
+
+// JSONEncodeIndent JSON encodes D into w, like JSONEncode but with indentation.
+// Each element begins on a new line beginning with prefix followed by one or more copies of indent.
+func (d *D) JSONEncodeIndent(w io.Writer, prefix, indent string) error {
+	err := d.cycle()
+	if err != nil {
+		return err
+	}
+	enc := d.jsonEncoder(w)
+	enc.SetIndent(prefix, indent)
+	return enc.Encode(d.jsonData())
+}
+
+// Dump returns the data of D as an indented JSON, for debugging purposes.
+// As String is an accessor, D can not implement the fmt.Stringer interface.
+// If the data can not be JSON encoded, its default format is used, or the error if it references itself.
+func (d *D) Dump() string {
+	if d == nil {
+		return "null"
+	}
+	if err := d.cycle(); err != nil {
+		return err.Error()
+	}
+	var buf bytes.Buffer
+	enc := d.jsonEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d.D); err != nil {
+		return fmt.Sprintf("%v", d.D)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// JSONEncodeOrdered JSON encodes D into w, like JSONEncode but with the keys of each object in the order
+// they have been read by the JSON unmarshalling with the JSONKeepOrder setting.
+// The keys of any object or key added since are encoded in their lexical order, after the others.
+func (d *D) JSONEncodeOrdered(w io.Writer) error {
+	err := d.cycle()
+	if err != nil {
+		return err
+	}
+	v := d.jsonData()
+	if d != nil {
+		v = d.ordered(nil, v)
+	}
+	return d.jsonEncoder(w).Encode(v)
+}
+
+// ordered returns the data to JSON encode with the recorded order of the keys of the object behind the path.
+func (d *D) ordered(path []string, v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if x == nil {
+			return x
+		}
+		var (
+			o = orderedObject{
+				keys:       make([]string, 0, len(x)),
+				values:     make(map[string]interface{}, len(x)),
+				escapeHTML: !d.jsonNoEscapeHTML,
+			}
+			add = func(k string) {
+				if _, ok := o.values[k]; !ok {
+					o.keys = append(o.keys, k)
+					o.values[k] = d.ordered(append(path, k), x[k])
+				}
+			}
+		)
+		for _, k := range d.keyOrder[pointer(path)] {
+			if _, ok := x[k]; ok {
+				add(k)
+			}
+		}
+		for _, k := range sortedKeys(x) {
+			add(k)
+		}
+		return o
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for k, v := range x {
+			out[k] = d.ordered(append(path, strconv.Itoa(k)), v)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// orderedObject is a JSON object whose keys are encoded in the given order.
+type orderedObject struct {
+	keys       []string
+	values     map[string]interface{}
+	escapeHTML bool
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		enc = json.NewEncoder(&buf)
+	)
+	enc.SetEscapeHTML(o.escapeHTML)
+	buf.WriteByte('{')
+	for k, v := range o.keys {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		// The new lines added by the encoder are removed once the output compacted.
+		err := enc.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		err = enc.Encode(o.values[v])
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (d *D) jsonEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	if d != nil && d.jsonNoEscapeHTML {
+		enc.SetEscapeHTML(false)
+	}
+	return enc
+}
+
+// jsonData returns the data to JSON encode.
+func (d *D) jsonData() interface{} {
+	if d == nil {
+		return nil
+	}
+	if d.omitEmpty && d.D != nil {
+		return d.pruned(d.D)
+	}
+	return d.D
+}
+
+// pruned returns a copy of the object without its empty objects, nor its nil values if OmitNil is used.
+// An object only containing such properties is also pruned.
+func (d *D) pruned(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if x = d.pruned(x); len(x) > 0 {
+				out[k] = x
+			}
+		case []interface{}:
+			out[k] = d.prunedArray(x)
+		case nil:
+			if !d.omitNil {
+				out[k] = nil
+			}
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// prunedArray returns a copy of the array where each object is pruned.
+// Its elements are kept, even empty, to not change their index.
+func (d *D) prunedArray(a []interface{}) []interface{} {
+	out := make([]interface{}, len(a))
+	for k, v := range a {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			out[k] = d.pruned(x)
+		case []interface{}:
+			out[k] = d.prunedArray(x)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d *D) MarshalJSON() ([]byte, error) {
+	err := d.cycle()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d.jsonData())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *D) UnmarshalJSON(b []byte) (err error) {
+	if d == nil {
+		return ErrInvalidTarget
+	}
+	if b == nil {
+		d.D = nil
+		return
+	}
+	err = d.limits(b)
+	if err != nil {
+		return err
+	}
+	var (
+		dec = json.NewDecoder(bytes.NewReader(b))
+		m   map[string]interface{}
+	)
+	dec.UseNumber()
+	err = dec.Decode(&m)
+	if err != nil {
+		return err
+	}
+	// Rejects any data after the first JSON value, D remaining unchanged.
+	_, err = dec.Token()
+	if err == nil {
+		return ErrTrailingData
+	}
+	if err != io.EOF {
+		return fmt.Errorf("%w: %s", ErrTrailingData, err.Error())
+	}
+	d.convertNumbers(m)
+	if d.internStrings {
+		interned(m, make(map[string]string))
+	}
+	// Prepares the result apart, D being only updated once validated.
+	c := d.sub(m)
+	if m != nil && d.D != nil {
+		// Like the JSON decoding into an existing map, the new keys are merged into the existing ones.
+		c.D = make(map[string]interface{}, len(d.D)+len(m))
+		for k, v := range d.D {
+			c.D[k] = v
+		}
+		for k, v := range m {
+			c.D[k] = v
+		}
+	}
+	if c.jsonKeepOrder {
+		c.keyOrder = make(map[string][]string)
+		dec = json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = c.order(dec, nil)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Validate()
+	if err != nil {
+		return err
+	}
+	*d = *c
+	return nil
+}
+
+// limits returns ErrLimitExceeded if the JSON data exceeds the MaxDepth or MaxKeys settings.
+// Its tokens are read without being stored, any malformed data being reported by the decoding.
+func (d *D) limits(b []byte) error {
+	if d.maxDepth == 0 && d.maxKeys == 0 {
+		return nil
+	}
+	const (
+		inArray = iota
+		inKey
+		inValue
+	)
+	var (
+		dec   = json.NewDecoder(bytes.NewReader(b))
+		stack []int
+		keys  int
+	)
+	dec.UseNumber()
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		n := len(stack)
+		if t == json.Delim('}') || t == json.Delim(']') {
+			stack = stack[:n-1]
+			continue
+		}
+		if n > 0 {
+			switch stack[n-1] {
+			case inKey:
+				stack[n-1] = inValue
+				continue
+			case inValue:
+				stack[n-1] = inKey
+			}
+			// Each property of an object and each value of an array is flattened as a key.
+			if err = d.maxKeysErr(keys + 1); err != nil {
+				return err
+			}
+			keys++
+		}
+		switch t {
+		case json.Delim('{'):
+			stack = append(stack, inKey)
+		case json.Delim('['):
+			stack = append(stack, inArray)
+		default:
+			continue
+		}
+		if err = d.maxDepthErr(len(stack)); err != nil {
+			return err
+		}
+	}
+}
+
+// maxDepthErr returns ErrLimitExceeded if the depth exceeds the MaxDepth setting.
+func (d *D) maxDepthErr(depth int) error {
+	if d.maxDepth > 0 && depth > d.maxDepth {
+		return fmt.Errorf("%w: more than %d levels", ErrLimitExceeded, d.maxDepth)
+	}
+	return nil
+}
+
+// maxKeysErr returns ErrLimitExceeded if the number of keys exceeds the MaxKeys setting.
+func (d *D) maxKeysErr(keys int) error {
+	if d.maxKeys > 0 && keys > d.maxKeys {
+		return fmt.Errorf("%w: more than %d keys", ErrLimitExceeded, d.maxKeys)
+	}
+	return nil
+}
+
+// order records the order of the keys of each object read from dec, by the JSON pointer of its path.
+func (d *D) order(dec *json.Decoder, path []string) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case json.Delim('{'):
+		var (
+			keys []string
+			seen = make(map[string]struct{})
+		)
+		for dec.More() {
+			t, err = dec.Token()
+			if err != nil {
+				return err
+			}
+			k, _ := t.(string)
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+			err = d.order(dec, append(path, k))
+			if err != nil {
+				return err
+			}
+		}
+		d.keyOrder[pointer(path)] = keys
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			err = d.order(dec, append(path, strconv.Itoa(i)))
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	// Consumes the end of the object or of the array.
+	_, err = dec.Token()
+	return err
+}
+
+// ToStruct stores D in the value pointed to by v, as the JSON decoding of D would.
+// The json tags of the fields are respected and numbers can also be decoded as json.Number.
+// ErrInvalidTarget is returned if v is not a non-nil pointer.
+func (d *D) ToStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("%w: non-nil pointer expected, got %T", ErrInvalidTarget, v)
+	}
+	if d == nil {
+		return nil
+	}
+	b, err := d.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// convertNumbers converts in place the json.Number of v, as defined by the Numbers setting.
+func (d *D) convertNumbers(v interface{}) {
+	if d.numbers == NumberJSON {
 		return
 	}
-	dec := json.NewDecoder(bytes.NewReader(b))
-	dec.UseNumber()
-	return dec.Decode(&d.D)
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, w := range x {
+			if n, ok := w.(json.Number); ok {
+				x[k] = d.convertNumber(n)
+				continue
+			}
+			d.convertNumbers(w)
+		}
+	case []interface{}:
+		for k, w := range x {
+			if n, ok := w.(json.Number); ok {
+				x[k] = d.convertNumber(n)
+				continue
+			}
+			d.convertNumbers(w)
+		}
+	}
+}
+
+func (d *D) convertNumber(n json.Number) interface{} {
+	if d.numbers == NumberAuto {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if isIntegral(n) {
+			// Out of the int64 range: a float64 would lose its precision.
+			return n
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	if d.numbers == NumberAuto && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+	return f
+}
+
+// isIntegral returns true if the number is written without fraction nor exponent.
+func isIntegral(n json.Number) bool {
+	return !strings.ContainsAny(n.String(), ".eE")
+}
+
+// Scan implements the sql.Scanner interface to read D from a JSON column.
+// Any previous data is discarded and a SQL NULL results in a nil document.
+func (d *D) Scan(src interface{}) error {
+	if d == nil {
+		return ErrInvalidTarget
+	}
+	var b []byte
+	switch x := src.(type) {
+	case nil:
+		d.D = nil
+		return nil
+	case []byte:
+		b = x
+	case string:
+		b = []byte(x)
+	default:
+		return newErrOutOfRange(b, src)
+	}
+	d.D = nil
+	return d.UnmarshalJSON(b)
+}
+
+// Value implements the driver.Valuer interface to store D in a JSON column.
+// A nil document is stored as a SQL NULL.
+func (d *D) Value() (driver.Value, error) {
+	if d == nil || d.D == nil {
+		return nil, nil
+	}
+	return d.MarshalJSON()
+}
+
+// GobEncode implements the gob.GobEncoder interface to encode the data of D.
+// The settings are not encoded.
+func (d *D) GobEncode() ([]byte, error) {
+	var m map[string]interface{}
+	if d != nil {
+		err := d.cycle()
+		if err != nil {
+			return nil, err
+		}
+		m = d.D
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements the gob.GobDecoder interface to decode the data of D.
+func (d *D) GobDecode(b []byte) error {
+	if d == nil {
+		return ErrInvalidTarget
+	}
+	var m map[string]interface{}
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&m)
+	if err != nil {
+		return err
+	}
+	d.D = m
+	return nil
 }
 
 // XMLEncode XML encodes D into w.
@@ -253,32 +2947,139 @@ func (d *D) XMLEncode(w io.Writer) error {
 
 // MarshalXML implements the xml.Marshaler interface.
 func (d *D) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
-	if len(d.D) == 0 {
+	if d == nil || len(d.D) == 0 {
 		return nil
 	}
+	err := d.cycle()
+	if err != nil {
+		return err
+	}
 	start.Name.Local = d.xmlName
 	start.Name.Space = d.xmlns
-	start.Attr = d.xmlAttributes
-	return marshallXML(d.D, enc, start, d.xmlArraySep)
+	start.Attr = append([]xml.Attr(nil), d.xmlAttributes...)
+	if d.xmlNilAttr {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: xsiNSAttr}, Value: xsiNS})
+	}
+	return d.marshalXML(d.D, enc, start)
 }
 
-type charData struct {
+// CDATA is a string value to encode as an XML CDATA section rather than as escaped character data.
+type CDATA string
+
+type cdata struct {
 	XMLName xml.Name
-	Value   string `xml:",chardata"`
+	Value   string `xml:",cdata"`
 }
 
-func marshallXML(m map[string]interface{}, enc *xml.Encoder, start xml.StartElement, arraySep string) error {
+func (d *D) marshalXML(m map[string]interface{}, enc *xml.Encoder, start xml.StartElement) error {
+	var (
+		attr = d.xmlAttrPrefix != ""
+		text string
+	)
+	if attr {
+		for _, k := range sortedKeys(m) {
+			if strings.HasPrefix(k, d.xmlAttrPrefix) {
+				start.Attr = append(start.Attr, xml.Attr{
+					Name:  xml.Name{Local: strings.TrimPrefix(k, d.xmlAttrPrefix)},
+					Value: d.fmtString(m[k]),
+				})
+			}
+		}
+	}
 	err := enc.EncodeToken(start)
 	if err != nil {
 		return err
 	}
-	for k, v := range m {
-		d, ok := v.(map[string]interface{})
-		if ok {
-			err = marshallXML(d, enc, xml.StartElement{Name: xml.Name{Local: k}}, arraySep)
-		} else {
-			err = enc.Encode(charData{XMLName: xml.Name{Local: k}, Value: fmtString(v, arraySep)})
+	// Sorts the keys for a reproducible output.
+	for _, k := range sortedKeys(m) {
+		v := m[k]
+		if attr {
+			if k == XMLTextKey {
+				text = d.xmlCharData(v)
+				continue
+			}
+			if strings.HasPrefix(k, d.xmlAttrPrefix) {
+				continue
+			}
+		}
+		err = d.marshalXMLValue(k, v, enc)
+		if err != nil {
+			return err
+		}
+	}
+	if text != "" {
+		err = enc.EncodeToken(xml.CharData(text))
+		if err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+func (d *D) marshalXMLValue(k string, v interface{}, enc *xml.Encoder) error {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return d.marshalXML(x, enc, xml.StartElement{Name: xml.Name{Local: k}})
+	case []interface{}:
+		if d.xmlArrayElem == "" {
+			break
+		}
+		return d.marshalXMLArray(x, enc, xml.StartElement{Name: xml.Name{Local: k}})
+	case nil:
+		if !d.xmlNilAttr {
+			break
+		}
+		return d.marshalXMLNil(enc, xml.StartElement{Name: xml.Name{Local: k}})
+	case CDATA:
+		return enc.Encode(cdata{XMLName: xml.Name{Local: k}, Value: string(x)})
+	}
+	return d.marshalXMLCharData(k, d.xmlCharData(v), enc)
+}
+
+// xmlCharData returns the value as XML character data, trimmed if the XMLTrimValues setting is enabled.
+func (d *D) xmlCharData(v interface{}) string {
+	if d.xmlTrimValues {
+		return strings.TrimSpace(d.fmtString(v))
+	}
+	return d.fmtString(v)
+}
+
+// bufPool reuses the buffers used to convert the character data to encode.
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// marshalXMLCharData encodes the value as an element named k, using tokens rather than reflection
+// and a pooled buffer to limit the allocations.
+func (d *D) marshalXMLCharData(k, v string, enc *xml.Encoder) error {
+	start := xml.StartElement{Name: xml.Name{Local: k}}
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		buf := bufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		buf.WriteString(v)
+		err = enc.EncodeToken(xml.CharData(buf.Bytes()))
+		bufPool.Put(buf)
+		if err != nil {
+			return err
 		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// marshalXMLArray encodes each value of the array as an element named as defined by XMLArrayElement.
+func (d *D) marshalXMLArray(a []interface{}, enc *xml.Encoder, start xml.StartElement) error {
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	for _, v := range a {
+		err = d.marshalXMLValue(d.xmlArrayElem, v, enc)
 		if err != nil {
 			return err
 		}
@@ -286,8 +3087,20 @@ func marshallXML(m map[string]interface{}, enc *xml.Encoder, start xml.StartElem
 	return enc.EncodeToken(start.End())
 }
 
+func (d *D) marshalXMLNil(enc *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: xsiNilAttr}, Value: "true"})
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
 // UnmarshalXML implements the xml.Unmarshaler interface.
 func (d *D) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	if d == nil {
+		return ErrInvalidTarget
+	}
 	var (
 		attr = func(list []xml.Attr) map[string]string {
 			m := make(map[string]string, len(list))
@@ -298,14 +3111,34 @@ func (d *D) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
 		}(start.Attr)
 		tree       = []string{xmlName(start.Name, attr)}
 		temp       = make(map[string]interface{})
+		list       = make(map[string]int)
 		name, data string
-		grow       bool
+		grow, with bool
+		keys       int
 	)
 	for token, err := dec.Token(); err == nil; token, err = dec.Token() {
 		switch t := token.(type) {
 		case xml.StartElement:
-			tree = append(tree, xmlName(t.Name, attr))
+			// Each element is a property of the object of its parent, the root element being the first object.
+			keys++
+			if err = d.maxKeysErr(keys); err != nil {
+				return err
+			}
+			if err = d.maxDepthErr(len(tree)); err != nil {
+				return err
+			}
+			name = xmlName(t.Name, attr)
+			if d.xmlArrayElem != "" && name == d.xmlArrayElem {
+				// Names each element of the array by its index.
+				k := strings.Join(tree, xmlLevelSep)
+				name = strconv.Itoa(list[k])
+				list[k]++
+			}
+			tree = append(tree, name)
 			grow = true
+			with = d.xmlAttr(temp, strings.Join(tree, xmlLevelSep), t.Attr, attr)
+			// Forgets the whitespace between the elements.
+			data = ""
 		case xml.CharData:
 			data = string(t)
 		case xml.EndElement:
@@ -313,68 +3146,389 @@ func (d *D) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
 			if !grow {
 				continue
 			}
-			temp[strings.Join(append(tree, name), xmlLevelSep)] = data
 			grow = false
+			blank := !d.xmlKeepSpace && strings.TrimSpace(data) == ""
+			if d.xmlDecode != nil && !blank {
+				var err error
+				if data, err = d.xmlDecode(data); err != nil {
+					return fmt.Errorf("%w: %s", err, strings.Join(append(tree, name), xmlLevelSep))
+				}
+			}
+			if !with {
+				var v interface{}
+				if !blank {
+					v = d.xmlValue(data)
+				}
+				temp[strings.Join(append(tree, name), xmlLevelSep)] = v
+				continue
+			}
+			if strings.TrimSpace(data) != "" {
+				temp[strings.Join(append(tree, name, XMLTextKey), xmlLevelSep)] = d.xmlValue(data)
+			}
+		}
+	}
+	d.D = make(map[string]interface{})
+	err := expanded(temp, d.D)
+	if err != nil {
+		return err
+	}
+	arrayed(list, d.xmlArrayElem, d.D)
+	if d.internStrings {
+		interned(d.D, make(map[string]string))
+	}
+	return nil
+}
+
+// interned replaces in place each string value of v by the first equal one stored in the pool.
+func interned(v interface{}, pool map[string]string) {
+	intern := func(s string) string {
+		if p, ok := pool[s]; ok {
+			return p
+		}
+		pool[s] = s
+		return s
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, w := range x {
+			if s, ok := w.(string); ok {
+				x[k] = intern(s)
+				continue
+			}
+			interned(w, pool)
+		}
+	case []interface{}:
+		for k, w := range x {
+			if s, ok := w.(string); ok {
+				x[k] = intern(s)
+				continue
+			}
+			interned(w, pool)
+		}
+	}
+}
+
+// ParseXML reads the XML data from r and calls fn for each element without child element, as soon as it ends,
+// with the names of its hierarchy, except the root element, and its character data as it is.
+// Unlike UnmarshalXML, the data is never fully held in memory, which allows to process huge documents.
+// Attributes are ignored. ParseXML stops at the first error returned by fn or by the decoding and returns it.
+func ParseXML(r io.Reader, fn func(path []string, value string) error) error {
+	var (
+		dec   = xml.NewDecoder(r)
+		space = make(map[string]string)
+		path  []string
+		data  []byte
+		leaf  bool
+	)
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			for _, v := range t.Attr {
+				if v.Name.Space == xmlNSAttr {
+					space[v.Value] = v.Name.Local
+				}
+			}
+			path = append(path, xmlName(t.Name, space))
+			data = data[:0]
+			leaf = true
+		case xml.CharData:
+			if leaf {
+				data = append(data, t...)
+			}
+		case xml.EndElement:
+			if leaf && len(path) > 1 {
+				// Forces a copy of the path to not share it between calls.
+				err = fn(append([]string(nil), path[1:]...), string(data))
+				if err != nil {
+					return err
+				}
+			}
+			// Its parent has at least this child element.
+			leaf = false
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// arrayed converts into arrays the objects listed with their number of elements, each one named by its index.
+// The deepest objects are converted first, to still reach them through their parents.
+// In an object kept because of other elements, the elements of the array get back their name.
+func arrayed(list map[string]int, name string, out map[string]interface{}) {
+	paths := make([]string, 0, len(list))
+	for k := range list {
+		paths = append(paths, k)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Count(paths[i], xmlLevelSep) > strings.Count(paths[j], xmlLevelSep)
+	})
+	for _, path := range paths {
+		// The root element can not be an array.
+		p := strings.Split(path, xmlLevelSep)[1:]
+		if len(p) == 0 {
+			renamed(out, list[path], name)
+			continue
+		}
+		var (
+			m  = out
+			ok = true
+		)
+		for i := 0; ok && i < len(p)-1; i++ {
+			m, ok = m[p[i]].(map[string]interface{})
+		}
+		if !ok {
+			continue
+		}
+		o, ok := m[p[len(p)-1]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if len(o) != list[path] {
+			// Keeps the object when other elements than the ones of the array are present.
+			renamed(o, list[path], name)
+			continue
+		}
+		a := make([]interface{}, len(o))
+		for k := range a {
+			a[k] = o[strconv.Itoa(k)]
+		}
+		m[p[len(p)-1]] = a
+	}
+}
+
+// renamed stores under their name the n elements of the object named by their index,
+// as a single value or as an array if the element is repeated.
+func renamed(o map[string]interface{}, n int, name string) {
+	a := make([]interface{}, n)
+	for k := range a {
+		i := strconv.Itoa(k)
+		a[k] = o[i]
+		delete(o, i)
+	}
+	if n == 1 {
+		o[name] = a[0]
+		return
+	}
+	o[name] = a
+}
+
+// xmlAttr stores the attributes of the XML element, if requested, and returns true if at least one was stored.
+// Namespace declarations are ignored.
+func (d *D) xmlAttr(temp map[string]interface{}, path string, list []xml.Attr, space map[string]string) bool {
+	if d.xmlAttrPrefix == "" {
+		return false
+	}
+	var ok bool
+	for _, a := range list {
+		if a.Name.Space == xmlNSAttr || a.Name.Local == xmlNSAttr {
+			continue
+		}
+		temp[path+xmlLevelSep+d.xmlAttrPrefix+xmlName(a.Name, space)] = d.xmlScalar(a.Value)
+		ok = true
+	}
+	return ok
+}
+
+// xmlValue returns the XML character data as a value, splitting arrays and inferring types if requested.
+func (d *D) xmlValue(s string) interface{} {
+	if !d.xmlSplitArrays || d.xmlArraySep == "" || !strings.Contains(s, d.xmlArraySep) {
+		return d.xmlScalar(s)
+	}
+	a := strings.Split(s, d.xmlArraySep)
+	v := make([]interface{}, len(a))
+	for k, s := range a {
+		v[k] = d.xmlScalar(s)
+	}
+	return v
+}
+
+func (d *D) xmlScalar(s string) interface{} {
+	if !d.xmlInferTypes {
+		return s
+	}
+	return inferType(s)
+}
+
+func expanded(in, out map[string]interface{}) error {
+	var (
+		a  []string
+		mv = func(m map[string]interface{}, to []string) map[string]interface{} {
+			for i := 0; i < len(to)-1; i++ {
+				_, ok := m[to[i]]
+				if !ok {
+					m[to[i]] = make(map[string]interface{})
+				}
+				m = m[to[i]].(map[string]interface{})
+			}
+			return m
+		}
+	)
+	for k, v := range in {
+		a = strings.Split(k, xmlLevelSep)
+		mv(out, a[1:])[a[len(a)-1]] = v
+	}
+	return nil
+}
+
+const (
+	xmlNSAttr   = "xmlns"
+	xmlNSSep    = ":"
+	xmlLevelSep = ">"
+	xsiNS       = "http://www.w3.org/2001/XMLSchema-instance"
+	xsiNSAttr   = xmlNSAttr + xmlNSSep + "xsi"
+	xsiNilAttr  = "xsi:nil"
+)
+
+func xmlName(name xml.Name, space map[string]string) string {
+	if ns, ok := space[name.Space]; ok {
+		return ns + xmlNSSep + name.Local
+	}
+	return name.Local
+}
+
+// BigFloat forces the returned value behind these keys as a *big.Float.
+// Unlike Float64, the precision of the number is not narrowed to 64 bits.
+// An error is returned if the key does not exist or if the requested type is wrong.
+func (d *D) BigFloat(keys ...string) (*big.Float, error) {
+	m, err := d.number((*big.Float)(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	return toBigFloat(m)
+}
+
+// BigInt forces the returned value behind these keys as a *big.Int.
+// Unlike Int64 or Uint64, the value is not limited to 64 bits.
+// An error is returned if the key does not exist or if the requested type is wrong.
+func (d *D) BigInt(keys ...string) (*big.Int, error) {
+	m, err := d.number((*big.Int)(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	return toBigInt(m)
+}
+
+// Bool forces the returned value behind these keys as a bool.
+// An error is returned if the key does not exist or if the requested type is wrong.
+func (d *D) Bool(keys ...string) (bool, error) {
+	m, err := d.number(false, keys)
+	if err != nil {
+		return false, err
+	}
+	return toBool(m)
+}
+
+// ShouldBool returns the value behind these keys as a bool.
+// The default type value is used if the key does not exist or if the data failed to be cast as a boolean.
+func (d *D) ShouldBool(keys ...string) bool {
+	v, _ := d.Bool(keys...)
+	return v
+}
+
+// BoolOr returns the value behind these keys as a bool.
+// The value def is used if the key does not exist or if the data failed to be cast as a boolean.
+func (d *D) BoolOr(def bool, keys ...string) bool {
+	v, err := d.Bool(keys...)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Bytes returns the value behind these keys as a slice of bytes, decoding it as a standard base64 string.
+// An error is returned if the key does not exist, if the requested type is wrong or if the data is not valid base64.
+func (d *D) Bytes(keys ...string) ([]byte, error) {
+	return d.bytes(base64.StdEncoding, keys)
+}
+
+// BytesRaw returns the value behind these keys as a slice of bytes,
+// decoding it as a standard base64 string without padding.
+// An error is returned if the key does not exist, if the requested type is wrong or if the data is not valid base64.
+func (d *D) BytesRaw(keys ...string) ([]byte, error) {
+	return d.bytes(base64.RawStdEncoding, keys)
+}
+
+func (d *D) bytes(enc *base64.Encoding, keys []string) ([]byte, error) {
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return nil, err
+	}
+	s, err := toString(m, d.layout())
+	if err != nil {
+		return nil, err
+	}
+	b, err := enc.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBase64, err.Error())
+	}
+	return b, nil
+}
+
+// Bools returns if exists, the content of the given key as a slice of booleans.
+func (d *D) Bools(keys ...string) ([]bool, error) {
+	v, err := d.array([]bool(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]bool, len(v))
+	for k2, v2 := range v {
+		err = d.native(false, v2)
+		if err != nil {
+			return nil, err
+		}
+		a[k2], err = toBool(v2)
+		if err != nil {
+			return nil, err
 		}
 	}
-	d.D = make(map[string]interface{})
-	return expanded(temp, d.D)
+	return a, nil
 }
 
-func expanded(in, out map[string]interface{}) error {
-	var (
-		a  []string
-		mv = func(m map[string]interface{}, to []string) map[string]interface{} {
-			for i := 0; i < len(to)-1; i++ {
-				_, ok := m[to[i]]
-				if !ok {
-					m[to[i]] = make(map[string]interface{})
-				}
-				m = m[to[i]].(map[string]interface{})
-			}
-			return m
-		}
-	)
-	for k, v := range in {
-		a = strings.Split(k, xmlLevelSep)
-		mv(out, a[1:])[a[len(a)-1]] = v
+// Duration forces the returned value behind these keys as a time.Duration.
+// A string is parsed as a Go duration, like "1h30m", whereas a number is used as nanoseconds.
+// An error is returned if the key does not exist or if the requested type is wrong.
+func (d *D) Duration(keys ...string) (time.Duration, error) {
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return toDuration(m)
 }
 
-const (
-	xmlNSSep    = ":"
-	xmlLevelSep = ">"
-)
-
-func xmlName(name xml.Name, space map[string]string) string {
-	if ns, ok := space[name.Space]; ok {
-		return ns + xmlNSSep + name.Local
-	}
-	return name.Local
+// ShouldDuration returns the value behind these keys as a time.Duration.
+// The default type value is used if the key does not exist or if the data failed to be cast as a time.Duration.
+func (d *D) ShouldDuration(keys ...string) time.Duration {
+	v, _ := d.Duration(keys...)
+	return v
 }
 
-// Bool forces the returned value behind these keys as a bool.
-// An error is returned if the key does not exist or if the requested type is wrong.
-func (d *D) Bool(keys ...string) (bool, error) {
-	m, err := d.Lookup(keys...)
+// Float32 forces the returned value behind these keys as a float32.
+// An error is returned if the key does not exist, if the requested type is wrong or if the value overflows.
+func (d *D) Float32(keys ...string) (float32, error) {
+	m, err := d.number(float32(0), keys)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	return toBool(m)
+	return toFloat32(m)
 }
 
-// ShouldBool returns the value behind these keys as a bool.
-// The default type value is used if the key does not exist or if the data failed to be cast as a boolean.
-func (d *D) ShouldBool(keys ...string) bool {
-	v, _ := d.Bool(keys...)
+// ShouldFloat32 returns the value behind these keys as a float32.
+// The default type value is used if the key does not exist or if the data failed to be cast as a float32.
+func (d *D) ShouldFloat32(keys ...string) float32 {
+	v, _ := d.Float32(keys...)
 	return v
 }
 
 // Float64 forces the returned value behind these keys as a float64.
 // An error is returned if the key does not exist or if the requested type is wrong.
 func (d *D) Float64(keys ...string) (float64, error) {
-	m, err := d.Lookup(keys...)
+	m, err := d.number(float64(0), keys)
 	if err != nil {
 		return 0, err
 	}
@@ -388,14 +3542,121 @@ func (d *D) ShouldFloat64(keys ...string) float64 {
 	return v
 }
 
+// Float64Or returns the value behind these keys as a float64.
+// The value def is used if the key does not exist or if the data failed to be cast as a float64.
+func (d *D) Float64Or(def float64, keys ...string) float64 {
+	v, err := d.Float64(keys...)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Float64s returns if exists, the content of the given key as a slice of float64.
+func (d *D) Float64s(keys ...string) ([]float64, error) {
+	v, err := d.array([]float64(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]float64, len(v))
+	for k2, v2 := range v {
+		err = d.native(float64(0), v2)
+		if err != nil {
+			return nil, err
+		}
+		a[k2], err = toFloat64(v2)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Get forces the returned value behind these keys as a T.
+// Supported types are: *big.Float, *big.Int, bool, float64, int, int64, string, time.Duration and uint64.
+// An error is returned if the key does not exist or if the requested type is wrong or not supported.
+func Get[T any](d *D, keys ...string) (T, error) {
+	var x T
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return x, err
+	}
+	switch any(x).(type) {
+	case string, time.Duration:
+	default:
+		err = d.native(x, m)
+		if err != nil {
+			return x, err
+		}
+	}
+	switch p := any(&x).(type) {
+	case **big.Float:
+		*p, err = toBigFloat(m)
+	case **big.Int:
+		*p, err = toBigInt(m)
+	case *bool:
+		*p, err = toBool(m)
+	case *float64:
+		*p, err = toFloat64(m)
+	case *int:
+		*p, err = toInt(m, d.base())
+	case *int64:
+		*p, err = toInt64(m, d.base())
+	case *string:
+		*p, err = toString(m, d.layout())
+	case *time.Duration:
+		*p, err = toDuration(m)
+	case *uint64:
+		*p, err = toUint64(m, d.base())
+	default:
+		return x, newErrOutOfRange(x, m)
+	}
+	return x, err
+}
+
+// Int forces the returned value behind these keys as an int.
+// An error is returned if the key does not exist, if the requested type is wrong
+// or if the value overflows an int on the current platform.
+func (d *D) Int(keys ...string) (int, error) {
+	m, err := d.number(0, keys)
+	if err != nil {
+		return 0, err
+	}
+	return toInt(m, d.base())
+}
+
+// ShouldInt returns the value behind these keys as an int.
+// The default type value is used if the key does not exist or if the data failed to be cast as an int.
+func (d *D) ShouldInt(keys ...string) int {
+	v, _ := d.Int(keys...)
+	return v
+}
+
+// Int32 forces the returned value behind these keys as an int32.
+// An error is returned if the key does not exist, if the requested type is wrong or if the value overflows.
+func (d *D) Int32(keys ...string) (int32, error) {
+	m, err := d.number(int32(0), keys)
+	if err != nil {
+		return 0, err
+	}
+	return toInt32(m, d.base())
+}
+
+// ShouldInt32 returns the value behind these keys as an int32.
+// The default type value is used if the key does not exist or if the data failed to be cast as an int32.
+func (d *D) ShouldInt32(keys ...string) int32 {
+	v, _ := d.Int32(keys...)
+	return v
+}
+
 // Int64 forces the returned value behind these keys as an int64.
 // An error is returned if the key does not exist or if the requested type is wrong.
 func (d *D) Int64(keys ...string) (int64, error) {
-	m, err := d.Lookup(keys...)
+	m, err := d.number(int64(0), keys)
 	if err != nil {
 		return 0, err
 	}
-	return toInt64(m)
+	return toInt64(m, d.base())
 }
 
 // ShouldInt64 returns the value behind these keys as an int64.
@@ -405,6 +3666,122 @@ func (d *D) ShouldInt64(keys ...string) int64 {
 	return v
 }
 
+// Int64Or returns the value behind these keys as an int64.
+// The value def is used if the key does not exist or if the data failed to be cast as an int64.
+func (d *D) Int64Or(def int64, keys ...string) int64 {
+	v, err := d.Int64(keys...)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Int64s returns if exists, the content of the given key as a slice of int64.
+func (d *D) Int64s(keys ...string) ([]int64, error) {
+	v, err := d.array([]int64(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]int64, len(v))
+	for k2, v2 := range v {
+		err = d.native(int64(0), v2)
+		if err != nil {
+			return nil, err
+		}
+		a[k2], err = toInt64(v2, d.base())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Map returns the object behind these keys as a new D, sharing the settings of its parent.
+// An error is returned if the key does not exist or if the value is not an object.
+func (d *D) Map(keys ...string) (*D, error) {
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := m.(map[string]interface{})
+	if !ok {
+		return nil, newErrOutOfRange(v, m)
+	}
+	return d.sub(v), nil
+}
+
+// Maps returns the objects of the array behind these keys as new D, sharing the settings of their parent.
+// An error is returned if the key does not exist or if any element of the array is not an object.
+func (d *D) Maps(keys ...string) ([]*D, error) {
+	v, err := d.array([]map[string]interface{}(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]*D, len(v))
+	for k, v2 := range v {
+		m, ok := v2.(map[string]interface{})
+		if !ok {
+			return nil, newErrOutOfRange(m, v2)
+		}
+		a[k] = d.sub(m)
+	}
+	return a, nil
+}
+
+// GroupBy returns the objects of the array behind these keys grouped by the value of their property field,
+// as new D sharing the settings of their parent. See Maps and String.
+// An error is returned if any object does not have this property as a string.
+func (d *D) GroupBy(field string, keys ...string) (map[string][]*D, error) {
+	a, err := d.Maps(keys...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]*D)
+	for _, v := range a {
+		k, err := v.String(field)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = append(out[k], v)
+	}
+	return out, nil
+}
+
+// fmtString returns the value as a string, using the settings of D.
+func (d *D) fmtString(v interface{}) string {
+	return fmtString(v, d.xmlArraySep, d.layout())
+}
+
+// layout returns the layout to use to format a time.Time.
+func (d *D) layout() string {
+	if d == nil || d.timeLayout == "" {
+		return DefaultTimeLayout
+	}
+	return d.timeLayout
+}
+
+// autoBase is the base used to parse integers based on their prefix.
+const autoBase = -1
+
+// base returns the base to use to parse integers.
+func (d *D) base() int {
+	switch {
+	case d == nil || d.intBase == 0:
+		return base10
+	case d.intBase == autoBase:
+		return 0
+	default:
+		return d.intBase
+	}
+}
+
+// sub returns a new D based on the given data and sharing the settings of d.
+func (d *D) sub(m map[string]interface{}) *D {
+	c := *d
+	c.D = m
+	return &c
+}
+
 // String forces the returned value behind these keys as a string.
 // An error is returned if the key does not exist or if the requested type is wrong.
 func (d *D) String(keys ...string) (string, error) {
@@ -412,7 +3789,28 @@ func (d *D) String(keys ...string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return toString(m)
+	return toString(m, d.layout())
+}
+
+// StringAny returns the value behind these keys rendered as a string, whatever its scalar type.
+// Floating-point numbers are formatted without exponent, arrays are joined with the separator of the XML arrays
+// and nil is rendered as an empty string. An error is returned if the key does not exist or targets an object.
+func (d *D) StringAny(keys ...string) (string, error) {
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return "", err
+	}
+	switch v := m.(type) {
+	case map[string]interface{}:
+		var x string
+		return x, newErrOutOfRange(x, v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', precision, bits32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', precision, bits64), nil
+	default:
+		return d.fmtString(m), nil
+	}
 }
 
 // ShouldString returns the value behind these keys as a string.
@@ -422,20 +3820,25 @@ func (d *D) ShouldString(keys ...string) string {
 	return v
 }
 
+// StringOr returns the value behind these keys as a string.
+// The value def is used if the key does not exist or if the data failed to be cast as a string.
+func (d *D) StringOr(def string, keys ...string) string {
+	v, err := d.String(keys...)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
 // Strings returns if exists, the content of the given key as a slice of strings.
 func (d *D) Strings(keys ...string) ([]string, error) {
-	m, err := d.Lookup(keys...)
+	v, err := d.array([]string(nil), keys)
 	if err != nil {
 		return nil, err
 	}
-	v, ok := m.([]interface{})
-	if !ok {
-		var x []string
-		return nil, newErrOutOfRange(x, v)
-	}
 	a := make([]string, len(v))
 	for k2, v2 := range v {
-		a[k2], err = toString(v2)
+		a[k2], err = toString(v2, d.layout())
 		if err != nil {
 			return nil, err
 		}
@@ -443,17 +3846,102 @@ func (d *D) Strings(keys ...string) ([]string, error) {
 	return a, nil
 }
 
+// StringMatrix returns if exists, the content of the given key as a slice of slices of strings.
+// Each element of the array must be an array, whatever its length.
+func (d *D) StringMatrix(keys ...string) ([][]string, error) {
+	v, err := d.array([][]string(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	a := make([][]string, len(v))
+	for k2, v2 := range v {
+		r, ok := v2.([]interface{})
+		if !ok {
+			return nil, newErrOutOfRange([]string(nil), v2)
+		}
+		a[k2] = make([]string, len(r))
+		for k3, v3 := range r {
+			a[k2][k3], err = toString(v3, d.layout())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
+}
+
+// StringsJoin returns if exists, the content of the given key as strings joined with the separator sep.
+// If sep is empty, the separator of the XML arrays is used. See XMLArray.
+func (d *D) StringsJoin(sep string, keys ...string) (string, error) {
+	a, err := d.Strings(keys...)
+	if err != nil {
+		return "", err
+	}
+	if sep == "" {
+		sep = d.xmlArraySep
+	}
+	return strings.Join(a, sep), nil
+}
+
+func (d *D) array(exp interface{}, keys []string) ([]interface{}, error) {
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := m.([]interface{})
+	if !ok {
+		return nil, newErrOutOfRange(exp, m)
+	}
+	return v, nil
+}
+
+// number returns the value behind these keys, expected to be a boolean or a number like exp.
+func (d *D) number(exp interface{}, keys []string) (interface{}, error) {
+	m, err := d.Lookup(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return m, d.native(exp, m)
+}
+
+// native returns an error if the Strict setting is enabled and m is a string, exp being the expected type.
+func (d *D) native(exp, m interface{}) error {
+	if !d.strict {
+		return nil
+	}
+	switch m.(type) {
+	case string, CDATA:
+		return newErrOutOfRange(exp, m)
+	}
+	return nil
+}
+
 // Time tries to return the value behind the key as a time.Time matching the given time layout.
+// If the layout is empty, the value is parsed with time.RFC3339, then with time.RFC3339Nano.
+// A time.Time value is returned as it is.
 func (d *D) Time(layout string, keys ...string) (time.Time, error) {
 	m, err := d.Lookup(keys...)
 	if err != nil {
 		return time.Time{}, err
 	}
-	s, err := toString(m)
+	if t, ok := m.(time.Time); ok {
+		return t, nil
+	}
+	s, err := toString(m, d.layout())
 	if err != nil {
 		return time.Time{}, err
 	}
-	return time.Parse(layout, s)
+	if layout != "" {
+		return time.Parse(layout, s)
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	if t, err2 := time.Parse(time.RFC3339Nano, s); err2 == nil {
+		return t, nil
+	}
+	return time.Time{}, err
 }
 
 // ShouldTime returns the value behind these keys as a time.Time.
@@ -463,14 +3951,31 @@ func (d *D) ShouldTime(layout string, keys ...string) time.Time {
 	return v
 }
 
+// Uint32 forces the returned value behind these keys as an uint32.
+// An error is returned if the key does not exist, if the requested type is wrong or if the value overflows.
+func (d *D) Uint32(keys ...string) (uint32, error) {
+	m, err := d.number(uint32(0), keys)
+	if err != nil {
+		return 0, err
+	}
+	return toUint32(m, d.base())
+}
+
+// ShouldUint32 returns the value behind these keys as an uint32.
+// The default type value is used if the key does not exist or if the data failed to be cast as an uint32.
+func (d *D) ShouldUint32(keys ...string) uint32 {
+	v, _ := d.Uint32(keys...)
+	return v
+}
+
 // Uint64 forces the returned value behind these keys as an uint64.
 // An error is returned if the key does not exist or if the requested type is wrong.
 func (d *D) Uint64(keys ...string) (uint64, error) {
-	m, err := d.Lookup(keys...)
+	m, err := d.number(uint64(0), keys)
 	if err != nil {
 		return 0, err
 	}
-	return toUint64(m)
+	return toUint64(m, d.base())
 }
 
 // ShouldUint64 returns the value behind these keys as an uint64.
@@ -479,3 +3984,68 @@ func (d *D) ShouldUint64(keys ...string) uint64 {
 	v, _ := d.Uint64(keys...)
 	return v
 }
+
+// Uint64Or returns the value behind these keys as an uint64.
+// The value def is used if the key does not exist or if the data failed to be cast as an uint64.
+func (d *D) Uint64Or(def uint64, keys ...string) uint64 {
+	v, err := d.Uint64(keys...)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Uint64s returns if exists, the content of the given key as a slice of uint64.
+func (d *D) Uint64s(keys ...string) ([]uint64, error) {
+	v, err := d.array([]uint64(nil), keys)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]uint64, len(v))
+	for k2, v2 := range v {
+		err = d.native(uint64(0), v2)
+		if err != nil {
+			return nil, err
+		}
+		a[k2], err = toUint64(v2, d.base())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// UnixMilliTime returns the value behind these keys as a time.Time in UTC,
+// the value being the number of milliseconds elapsed since January 1, 1970 UTC.
+// An error is returned if the key does not exist or if the requested type is wrong.
+func (d *D) UnixMilliTime(keys ...string) (time.Time, error) {
+	i, err := d.unix(keys)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(i/msPerSecond, (i%msPerSecond)*int64(time.Millisecond)).UTC(), nil
+}
+
+// UnixTime returns the value behind these keys as a time.Time in UTC,
+// the value being the number of seconds elapsed since January 1, 1970 UTC.
+// An error is returned if the key does not exist or if the requested type is wrong.
+func (d *D) UnixTime(keys ...string) (time.Time, error) {
+	i, err := d.unix(keys)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(i, 0).UTC(), nil
+}
+
+// unix returns the timestamp behind these keys. Any value which is not an integer is out of range.
+func (d *D) unix(keys []string) (int64, error) {
+	m, err := d.number(int64(0), keys)
+	if err != nil {
+		return 0, err
+	}
+	i, err := toInt64(m, d.base())
+	if err != nil && !errors.Is(err, ErrOutOfRange) {
+		return 0, fmt.Errorf("%w: %s", newErrOutOfRange(i, m), err.Error())
+	}
+	return i, err
+}
@@ -40,6 +40,10 @@ func TestSimplify(t *testing.T) {
 					"string":   "value",
 				},
 			},
+			"Renamed as another key": {
+				in:  map[string]interface{}{"a_a_x": "first", "a_x": "second"},
+				out: map[string]interface{}{"a_x": "first", "x": "second"},
+			},
 			"OK": {
 				in:  map[string]interface{}{"geek_name": "value", "geek_age": float64(42)},
 				out: map[string]interface{}{"name": "value", "age": float64(42)},
@@ -54,3 +58,92 @@ func TestSimplify(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitKey(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in, sep string
+			out     []string
+		}{
+			"Default":   {out: []string{""}},
+			"Single":    {in: "a", sep: "_", out: []string{"a"}},
+			"Separated": {in: "x_a_b", sep: "_", out: []string{"x", "a", "b"}},
+			"Escaped":   {in: "x_a__b", sep: "_", out: []string{"x", "a_b"}},
+			"Tripled":   {in: "x___b", sep: "_", out: []string{"x_", "b"}},
+			"Long":      {in: "x..a....b", sep: "..", out: []string{"x", "a..b"}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, splitKey(tt.in, tt.sep)) // mismatch data
+		})
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in, out string
+		}{
+			"Default":    {},
+			"Camel case": {in: "userName", out: "user_name"}, // ambiguous, see EscapeKeySep
+			"Separator":  {in: "a_b", out: "a__b"},
+			"Both":       {in: "_userName_id", out: "user_name__id"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, escapeKey(tt.in)) // mismatch data
+		})
+	}
+}
+
+func TestD_childKey(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = &D{}
+		dt  = map[string]struct {
+			path []string
+			out  string
+		}{
+			"Default":         {path: []string{""}},
+			"Camel case":      {path: []string{"userName", "ID"}, out: "user_name_id"},
+			"Separators":      {path: []string{"_a-b_", " c d "}, out: "a_b_c_d"},
+			"Empty parent":    {path: []string{"--", "Geek"}, out: "geek"},
+			"Empty child":     {path: []string{"geek", "__"}, out: "geek"},
+			"Title after all": {path: []string{"HTTP", "Status", "code"}, out: "http_status_code"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, d.keyName(tt.path)) // mismatch data
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  string
+			n   int
+			out string
+		}{
+			"Default":   {},
+			"Short":     {in: "abc", n: 4, out: "abc"},
+			"Long":      {in: "abcdef", n: 4, out: "abcd"},
+			"Multibyte": {in: "abcdé", n: 5, out: "abcd"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, truncate(tt.in, tt.n)) // mismatch data
+		})
+	}
+}
@@ -6,15 +6,26 @@ package flat_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"io"
+	"math"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/matryer/is"
 	"github.com/rvflash/flat"
+	"github.com/rvflash/naming"
 
 	"gopkg.in/yaml.v3"
 )
@@ -65,6 +76,518 @@ object:
 string: Hello World`
 )
 
+func TestDecode(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in     string
+			format string
+			out    map[string]interface{}
+			err    error
+		}{
+			"Default":  {err: flat.ErrUnknownFormat},
+			"Unknown":  {in: jsonStr, format: "csv", err: flat.ErrUnknownFormat},
+			"Trailing": {in: `{"a":1} garbage`, format: flat.JSON, err: flat.ErrTrailingData},
+			"JSON": {in: jsonStr, format: flat.JSON, out: map[string]interface{}{
+				"array":    []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
+				"boolean":  true,
+				"null":     nil,
+				"number":   json.Number("123"),
+				"object_a": "b",
+				"object_c": "d",
+				"object_e": "f",
+				"string":   "Hello World",
+			}},
+			"XML": {in: xmlStr, format: flat.XML, out: map[string]interface{}{
+				"array":      "1|2|3",
+				"boolean":    "true",
+				"null":       nil,
+				"hyp_number": "123",
+				"object_a":   "b",
+				"object_c":   "d",
+				"object_e":   "f",
+				"string":     "Hello World",
+			}},
+			"YAML": {in: yamlStr, format: "YAML", out: map[string]interface{}{
+				"array":    []interface{}{1, 2, 3},
+				"boolean":  true,
+				"null":     nil,
+				"number":   123,
+				"object_a": "b",
+				"object_c": "d",
+				"object_e": "f",
+				"string":   "Hello World",
+			}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := flat.Decode(strings.NewReader(tt.in), tt.format)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.err == nil {
+				are.Equal("", cmp.Diff(tt.out, out.Flatten())) // mismatch data
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in, inFormat, outFormat string
+			opts                    []flat.Settings
+			out                     string
+			err                     error
+		}{
+			"Default":         {err: flat.ErrUnknownFormat},
+			"Unknown input":   {in: jsonStr, inFormat: "csv", outFormat: flat.XML, err: flat.ErrUnknownFormat},
+			"Unknown output":  {in: jsonStr, inFormat: flat.JSON, outFormat: "csv", err: flat.ErrUnknownFormat},
+			"Malformed input": {in: "{", inFormat: flat.JSON, outFormat: flat.YAML, err: io.ErrUnexpectedEOF},
+			"JSON to YAML": {
+				in:        jsonStr,
+				inFormat:  flat.JSON,
+				outFormat: flat.YAML,
+				opts:      []flat.Settings{flat.YAMLIndent(2)},
+				out: "array:\n  - 1\n  - 2\n  - 3\nboolean: true\n\"null\": null\nnumber: 123\n" +
+					"object:\n  a: b\n  c: d\n  e: f\nstring: Hello World\n",
+			},
+			"Large integer to YAML": {
+				in:        `{"id":12345678901234567890,"pi":3.14}`,
+				inFormat:  flat.JSON,
+				outFormat: flat.YAML,
+				out:       "id: 12345678901234567890\npi: 3.14\n",
+			},
+			"XML to JSON": {
+				in:        xmlStr,
+				inFormat:  flat.XML,
+				outFormat: "JSON",
+				out: `{"array":"1|2|3","boolean":"true","hyp:number":"123","null":null,` +
+					`"object":{"a":"b","c":"d","e":"f"},"string":"Hello World"}` + "\n",
+			},
+			"JSON to XML": {
+				in:        `{"a":{"b":1}}`,
+				inFormat:  flat.JSON,
+				outFormat: flat.XML,
+				opts:      []flat.Settings{flat.XMLName("data")},
+				out:       "<data><a><b>1</b></a></data>",
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := flat.Convert(strings.NewReader(tt.in), tt.inFormat, &buf, tt.outFormat, tt.opts...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, buf.String())  // mismatch data
+		})
+	}
+}
+
+// cancelReader cancels its context once n bytes read.
+type cancelReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		r.cancel()
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func TestDecodeContext(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in     string
+			format string
+			n      int
+			err    error
+		}{
+			"Unknown":   {in: jsonStr, format: "csv", n: len(jsonStr), err: flat.ErrUnknownFormat},
+			"Canceled":  {in: jsonStr, format: flat.JSON, err: context.Canceled},
+			"JSON":      {in: jsonStr, format: flat.JSON, n: 10, err: context.Canceled},
+			"XML":       {in: xmlStr, format: flat.XML, n: 10, err: context.Canceled},
+			"YAML":      {in: yamlStr, format: flat.YAML, n: 10, err: context.Canceled},
+			"Completed": {in: jsonStr, format: flat.JSON, n: len(jsonStr) + 1},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := &cancelReader{r: iotest.OneByteReader(strings.NewReader(tt.in)), n: tt.n, cancel: cancel}
+			out, err := flat.DecodeContext(ctx, r, tt.format)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.err == nil {
+				are.Equal("Hello World", out.ShouldString("string")) // mismatch data
+			} else {
+				are.Equal(nil, out) // unexpected data
+			}
+		})
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in   string
+			opts []flat.Settings
+			out  []map[string]interface{}
+			err  bool
+		}{
+			"Default": {},
+			"OK": {
+				in: "{\"a\":{\"b\":1}}\n{\"c\":true}\n",
+				out: []map[string]interface{}{
+					{"a": map[string]interface{}{"b": json.Number("1")}},
+					{"c": true},
+				},
+			},
+			"Concatenated": {
+				in:  `{"a":"b"}{"c":"d"}`,
+				out: []map[string]interface{}{{"a": "b"}, {"c": "d"}},
+			},
+			"Malformed": {
+				in:  "{\"a\":\"b\"}\n{\"c\":}\n",
+				out: []map[string]interface{}{{"a": "b"}},
+				err: true,
+			},
+			"Max depth": {
+				in:   "{\"a\":\"b\"}\n{\"c\":{\"d\":{\"e\":1}}}\n",
+				opts: []flat.Settings{flat.MaxDepth(1)},
+				out:  []map[string]interface{}{{"a": "b"}},
+				err:  true,
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			res, err := flat.DecodeStream(strings.NewReader(tt.in), tt.opts...)
+			are.Equal(tt.err, err != nil)    // mismatch error
+			are.Equal(len(tt.out), len(res)) // mismatch length
+			for k, d := range res {
+				are.Equal("", cmp.Diff(tt.out[k], d.D)) // mismatch data
+			}
+		})
+	}
+}
+
+func TestFromStruct(t *testing.T) {
+	type city struct {
+		Name string   `json:"name"`
+		Zips []string `json:"zips,omitempty"`
+	}
+	type geek struct {
+		Name   string  `json:"name"`
+		Age    int     `json:"age"`
+		Cities []city  `json:"cities"`
+		Home   *city   `json:"home"`
+		Ratio  float64 `json:"-"`
+	}
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out map[string]interface{}
+			err bool
+		}{
+			"Default":     {},
+			"Invalid":     {in: 42, err: true},
+			"Unsupported": {in: func() {}, err: true},
+			"OK": {
+				in: geek{
+					Name:   "rv",
+					Age:    42,
+					Cities: []city{{Name: "Paris", Zips: []string{"75001", "75002"}}},
+					Home:   &city{Name: "Paris"},
+					Ratio:  0.5,
+				},
+				out: map[string]interface{}{
+					"name": "rv",
+					"age":  json.Number("42"),
+					"cities": []interface{}{
+						map[string]interface{}{"name": "Paris", "zips": []interface{}{"75001", "75002"}},
+					},
+					"home_name": "Paris",
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d, err := flat.FromStruct(tt.in, flat.NoSimplify())
+			are.Equal(tt.err, err != nil) // mismatch error
+			if !tt.err {
+				are.Equal("", cmp.Diff(tt.out, d.Flatten())) // mismatch data
+			}
+		})
+	}
+}
+
+func TestNewFromFlat(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.NewFromFlat(map[string]interface{}{"db_host": "x", "db_name": "y"}, "", flat.XMLName("cfg"))
+	)
+	v, err := d.Lookup("db", "host")
+	are.NoErr(err)                               // unexpected error
+	are.Equal("x", v)                            // mismatch host
+	are.Equal("y", d.ShouldString("db", "name")) // mismatch name
+	b, err := xml.Marshal(d)
+	are.NoErr(err)                                                           // unexpected encoding error
+	are.Equal("<cfg><db><host>x</host><name>y</name></db></cfg>", string(b)) // mismatch settings
+	are.Equal(0, flat.NewFromFlat(nil, ".").Len())                           // mismatch empty data
+}
+
+func TestD_Clone(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"array":  []interface{}{"a", map[string]interface{}{"b": "c"}},
+			"object": map[string]interface{}{"a": "b"},
+		}, flat.XMLName("custom"))
+		c = d.Clone()
+	)
+	are.Equal("", cmp.Diff(d.D, c.D)) // mismatch copy
+	err := c.Set("z", "object", "a")
+	are.NoErr(err) // unexpected error
+	c.D["array"].([]interface{})[1].(map[string]interface{})["b"] = "z"
+	are.Equal("b", d.ShouldString("object", "a"))                                               // original object modified
+	are.Equal("", cmp.Diff([]interface{}{"a", map[string]interface{}{"b": "c"}}, d.D["array"])) // original array modified
+	b, err := xml.Marshal(c)
+	are.NoErr(err)                                      // unexpected encoding error
+	are.True(strings.HasPrefix(string(b), "<custom><")) // mismatch settings
+	are.Equal(nil, (*flat.D)(nil).Clone())              // unexpected clone
+}
+
+func TestD_Equal(t *testing.T) {
+	var (
+		j   = flat.D{}
+		y   = flat.D{}
+		are = is.New(t)
+	)
+	are.NoErr(json.Unmarshal([]byte(jsonStr), &j)) // unexpected JSON error
+	are.NoErr(yaml.Unmarshal([]byte(yamlStr), &y)) // unexpected YAML error
+	dt := map[string]struct {
+		a, b *flat.D
+		out  bool
+	}{
+		"Default":   {out: true},
+		"Blank":     {a: &flat.D{}, b: flat.New(map[string]interface{}{}), out: true},
+		"Identical": {a: &j, b: j.Clone(), out: true},
+		"Numbers":   {a: &j, b: &y, out: true},
+		"Different": {
+			a: flat.New(map[string]interface{}{"object": map[string]interface{}{"a": "b"}}),
+			b: flat.New(map[string]interface{}{"object": map[string]interface{}{"a": "c"}}),
+		},
+		"Missing": {a: &j, b: flat.New(map[string]interface{}{"string": "Hello World"})},
+		"Trailing zeros": {
+			a:   flat.New(map[string]interface{}{"a": json.Number("0.3"), "b": float64(0.3)}),
+			b:   flat.New(map[string]interface{}{"a": json.Number("0.300000000000000000"), "b": json.Number("0.300000000000000000")}),
+			out: true,
+		},
+		"Type": {
+			a: flat.New(map[string]interface{}{"number": "1"}),
+			b: flat.New(map[string]interface{}{"number": float64(1)}),
+		},
+	}
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, tt.a.Equal(tt.b)) // mismatch result
+			are.Equal(tt.out, tt.b.Equal(tt.a)) // mismatch symmetric result
+		})
+	}
+}
+
+func TestD_Contains(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"object": map[string]interface{}{"a": "b", "c": json.Number("1")},
+			"array":  []interface{}{"1", "2"},
+			"null":   nil,
+		})
+		dt = map[string]struct {
+			in     *flat.D
+			subset *flat.D
+			out    bool
+		}{
+			"Default":  {out: true},
+			"Empty":    {in: d, subset: &flat.D{}, out: true},
+			"Same":     {in: d, subset: d, out: true},
+			"Subset":   {in: d, subset: flat.New(map[string]interface{}{"object": map[string]interface{}{"c": 1.0}}), out: true},
+			"Null":     {in: d, subset: flat.New(map[string]interface{}{"null": nil}), out: true},
+			"Array":    {in: d, subset: flat.New(map[string]interface{}{"array": []interface{}{"1", "2"}}), out: true},
+			"Mismatch": {in: d, subset: flat.New(map[string]interface{}{"object": map[string]interface{}{"a": "z"}})},
+			"Missing":  {in: d, subset: flat.New(map[string]interface{}{"object": map[string]interface{}{"z": "b"}})},
+			"Partial array": {
+				in:     d,
+				subset: flat.New(map[string]interface{}{"array": []interface{}{"1"}}),
+			},
+			"Nil": {subset: flat.New(map[string]interface{}{"a": "b"})},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, tt.in.Contains(tt.subset)) // mismatch result
+		})
+	}
+}
+
+func TestD_Fingerprint(t *testing.T) {
+	var (
+		are = is.New(t)
+		dec = func(s string) *flat.D {
+			d := &flat.D{}
+			err := json.Unmarshal([]byte(s), d)
+			are.NoErr(err) // unexpected error
+			return d
+		}
+		dt = map[string]struct {
+			in, other *flat.D
+			same      bool
+		}{
+			"Default": {same: true},
+			"Blank":   {in: &flat.D{}, same: true},
+			"Reordered": {
+				in:    dec(`{"a":{"b":1,"c":[true,null]},"d":"e"}`),
+				other: dec(`{"d":"e","a":{"c":[true,null],"b":1}}`),
+				same:  true,
+			},
+			"Numbers": {
+				in:    dec(`{"a":1.5,"b":-0}`),
+				other: flat.New(map[string]interface{}{"a": float32(1.5), "b": int64(0)}),
+				same:  true,
+			},
+			"Trailing zeros": {
+				in:    dec(`{"a":0.300000000000000000}`),
+				other: flat.New(map[string]interface{}{"a": float64(0.3)}),
+				same:  true,
+			},
+			"Mismatch":   {in: dec(`{"a":"1"}`), other: dec(`{"a":1}`)},
+			"Array":      {in: dec(`{"a":["b","c"]}`), other: dec(`{"a":["c","b"]}`)},
+			"Nested key": {in: dec(`{"a":{"b":"c"}}`), other: dec(`{"a_b":"c"}`)},
+			"Sample":     {in: dec(jsonStr), other: dec(`{"string":"Hello World"}`)},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.same, tt.in.Equal(tt.other))                         // mismatch equality
+			are.Equal(tt.same, tt.in.Fingerprint() == tt.other.Fingerprint()) // mismatch fingerprint
+			are.Equal(64, len(tt.in.Fingerprint()))                           // mismatch length
+		})
+	}
+}
+
+func TestD_Diff(t *testing.T) {
+	var (
+		are = is.New(t)
+		a   = flat.New(map[string]interface{}{
+			"object":  map[string]interface{}{"a": "b", "c": json.Number("1"), "d": "e"},
+			"number":  float64(1),
+			"removed": "x",
+		})
+		b = flat.New(map[string]interface{}{
+			"object": map[string]interface{}{"a": "b", "c": 1, "d": "f"},
+			"number": json.Number("1.0"),
+			"added":  []interface{}{"y"},
+		})
+		dt = map[string]struct {
+			a, b                    *flat.D
+			added, removed, changed map[string]interface{}
+		}{
+			"Default": {
+				added:   map[string]interface{}{},
+				removed: map[string]interface{}{},
+				changed: map[string]interface{}{},
+			},
+			"Same": {
+				a:       a,
+				b:       a.Clone(),
+				added:   map[string]interface{}{},
+				removed: map[string]interface{}{},
+				changed: map[string]interface{}{},
+			},
+			"Nil other": {
+				a:       a,
+				added:   map[string]interface{}{},
+				removed: a.Flatten(),
+				changed: map[string]interface{}{},
+			},
+			"OK": {
+				a:       a,
+				b:       b,
+				added:   map[string]interface{}{"added": []interface{}{"y"}},
+				removed: map[string]interface{}{"removed": "x"},
+				changed: map[string]interface{}{"object_d": "f"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			added, removed, changed := tt.a.Diff(tt.b)
+			are.Equal("", cmp.Diff(tt.added, added))     // mismatch added
+			are.Equal("", cmp.Diff(tt.removed, removed)) // mismatch removed
+			are.Equal("", cmp.Diff(tt.changed, changed)) // mismatch changed
+		})
+	}
+}
+
+func TestD_Filter(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		dt  = map[string]struct {
+			keep [][]string
+			out  map[string]interface{}
+		}{
+			"Default": {out: map[string]interface{}{}},
+			"Unknown": {keep: [][]string{{"oops"}, {"object", "z"}}, out: map[string]interface{}{}},
+			"Object": {
+				keep: [][]string{{"object"}},
+				out:  map[string]interface{}{"object": map[string]interface{}{"a": "b", "c": "d", "e": "f"}},
+			},
+			"OK": {
+				keep: [][]string{{"object", "a"}, {"string"}},
+				out: map[string]interface{}{
+					"object": map[string]interface{}{"a": "b"},
+					"string": "Hello World",
+				},
+			},
+			"Array": {
+				keep: [][]string{{"array"}, {"array", "1"}},
+				out:  map[string]interface{}{"array": []interface{}{json.Number("1"), json.Number("2"), json.Number("3")}},
+			},
+			"Through array": {keep: [][]string{{"array", "1"}}, out: map[string]interface{}{}},
+		}
+	)
+	are.NoErr(err) // unexpected error
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := d.Filter(tt.keep...)
+			are.Equal("", cmp.Diff(tt.out, out.D)) // mismatch data
+		})
+	}
+}
+
 func TestD_Flatten(t *testing.T) {
 	var (
 		are = is.New(t)
@@ -122,45 +645,2024 @@ func TestD_Flatten(t *testing.T) {
 	}
 }
 
-func TestD_Lookup(t *testing.T) {
+func TestFlattenArrays(t *testing.T) {
 	var (
-		d = map[string]interface{}{
-			"object": map[string]interface{}{
-				"a": "b",
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  map[string]interface{}
+			out map[string]interface{}
+		}{
+			"Default": {},
+			"Empty array": {
+				in:  map[string]interface{}{"array": []interface{}{}, "string": "Hello World"},
+				out: map[string]interface{}{"string": "Hello World"},
+			},
+			"Array of scalars": {
+				in: map[string]interface{}{"array": []interface{}{float64(1), float64(2), float64(3)}, "boolean": true},
+				out: map[string]interface{}{
+					"array_0": float64(1),
+					"array_1": float64(2),
+					"array_2": float64(3),
+					"boolean": true,
+				},
+			},
+			"Array of objects": {
+				in: map[string]interface{}{
+					"items": []interface{}{
+						map[string]interface{}{"name": "a"},
+						map[string]interface{}{"name": "b", "tags": []interface{}{"c"}},
+					},
+					"string": "Hello World",
+				},
+				out: map[string]interface{}{
+					"items_0_name":   "a",
+					"items_1_name":   "b",
+					"items_1_tags_0": "c",
+					"string":         "Hello World",
+				},
 			},
 		}
-		are = is.New(t)
-		dt  = map[string]struct {
-			in   *flat.D
-			keys []string
-			out  interface{}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := flat.New(tt.in, flat.FlattenArrays()).Flatten()
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+}
+
+func TestArraysAsJSON(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			opts []flat.Settings
+			out  interface{}
+		}{
+			"Default": {out: []interface{}{json.Number("1"), json.Number("2"), json.Number("3")}},
+			"Arrays":  {opts: []flat.Settings{flat.ArraysAsJSON(), flat.FlattenArrays()}, out: nil},
+			"OK":      {opts: []flat.Settings{flat.ArraysAsJSON()}, out: "[1,2,3]"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil, tt.opts...)
+			err := json.Unmarshal([]byte(jsonStr), d)
+			are.NoErr(err)                                        // unexpected error
+			are.Equal("", cmp.Diff(tt.out, d.Flatten()["array"])) // mismatch data
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in, format string
+			max        int
+			err        error
+		}{
+			"Default":       {in: `{"a":{"b":{"c":[[1]]}}}`, format: flat.JSON},
+			"JSON":          {in: `{"a":{"b":{"c":[1]}}}`, format: flat.JSON, max: 4},
+			"JSON too deep": {in: `{"a":{"b":{"c":[[1]]}}}`, format: flat.JSON, max: 4, err: flat.ErrLimitExceeded},
+			"XML":           {in: `<r><a><b><c>1</c></b></a></r>`, format: flat.XML, max: 3},
+			"XML too deep":  {in: `<r><a><b><c><d>1</d></c></b></a></r>`, format: flat.XML, max: 3, err: flat.ErrLimitExceeded},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			_, err := flat.Decode(strings.NewReader(tt.in), tt.format, flat.MaxDepth(tt.max))
+			are.True(errors.Is(err, tt.err)) // mismatch error
+		})
+	}
+}
+
+func TestMaxKeys(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in, format string
+			max        int
+			err        error
+		}{
+			"Default":       {in: jsonStr, format: flat.JSON},
+			"JSON":          {in: jsonStr, format: flat.JSON, max: 12},
+			"JSON too wide": {in: jsonStr, format: flat.JSON, max: 11, err: flat.ErrLimitExceeded},
+			"Strings":       {in: `{"a":"b","c":["d","e"]}`, format: flat.JSON, max: 4},
+			"Wide array":    {in: `{"a":[1,2,3,4,5,6,7,8]}`, format: flat.JSON, max: 2, err: flat.ErrLimitExceeded},
+			"XML":           {in: xmlStr, format: flat.XML, max: 9},
+			"XML too wide":  {in: xmlStr, format: flat.XML, max: 8, err: flat.ErrLimitExceeded},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			_, err := flat.Decode(strings.NewReader(tt.in), tt.format, flat.MaxKeys(tt.max))
+			are.True(errors.Is(err, tt.err)) // mismatch error
+		})
+	}
+}
+
+func TestKeyCase(t *testing.T) {
+	var (
+		are  = is.New(t)
+		join = flat.KeyFunc(func(parts []string) string {
+			return strings.Join(parts, ".")
+		})
+		dt = map[string]struct {
+			opts []flat.Settings
+			key  string
+		}{
+			"Default":  {key: "object_a"},
+			"As is":    {opts: []flat.Settings{join, flat.KeyCase(flat.KeyAsIs)}, key: "Object.A"},
+			"Lower":    {opts: []flat.Settings{join, flat.KeyCase(flat.KeyLower)}, key: "object.a"},
+			"Upper":    {opts: []flat.Settings{flat.KeyCase(flat.KeyUpper)}, key: "OBJECT_A"},
+			"Prefixed": {opts: []flat.Settings{flat.KeyCase(flat.KeyUpper), flat.Prefix("app")}, key: "APP_OBJECT_A"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(map[string]interface{}{
+				"Object": map[string]interface{}{"A": "b", "C": "d"},
+				"String": "Hello World",
+			}, tt.opts...)
+			v, ok := d.Flatten()[tt.key]
+			are.True(ok)      // missing key
+			are.Equal("b", v) // mismatch value
+		})
+	}
+}
+
+func TestInternStrings(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in, format string
+		}{
+			"JSON": {in: `{"a":["x","x",{"b":"x"}],"c":"x","d":"y"}`, format: flat.JSON},
+			"XML":  {in: `<r><a><i>x</i><i>x</i></a><c>x</c><d>y</d></r>`, format: flat.XML},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			exp, err := flat.Decode(strings.NewReader(tt.in), tt.format, flat.XMLArrayElement("i"))
+			are.NoErr(err) // unexpected error
+			out, err := flat.Decode(strings.NewReader(tt.in), tt.format, flat.XMLArrayElement("i"), flat.InternStrings())
+			are.NoErr(err)                        // unexpected interned error
+			are.Equal("", cmp.Diff(exp.D, out.D)) // mismatch data
+		})
+	}
+}
+
+func TestD_FlattenTo(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.D{}
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		dst = map[string]interface{}{"old": "value", "string": "old"}
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	d.FlattenTo(dst)
+	are.Equal("", cmp.Diff(d.Flatten(), dst)) // mismatch data
+	d.FlattenTo(dst, []string{"object"})
+	are.Equal("", cmp.Diff(d.Flatten([]string{"object"}), dst)) // mismatch reused data
+	d = *flat.New(map[string]interface{}{"geek": map[string]interface{}{"name": "value", "age": float64(42)}})
+	d.FlattenTo(dst)
+	are.Equal("", cmp.Diff(map[string]interface{}{"name": "value", "age": float64(42)}, dst)) // mismatch simplified data
+	(&flat.D{}).FlattenTo(dst)
+	are.Equal(0, len(dst)) // expected empty map
+}
+
+func TestD_FlattenJSON(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	out, err := d.FlattenJSON([]string{"object", "c"})
+	are.NoErr(err) // unexpected error
+	exp, err := json.Marshal(d.Flatten([]string{"object", "c"}))
+	are.NoErr(err)                      // unexpected marshal error
+	are.Equal(string(exp), string(out)) // mismatch data
+	are.Equal(
+		`{"array":[1,2,3],"boolean":true,"null":null,"number":123,"object_a":"b","object_e":"f","string":"Hello World"}`,
+		string(out),
+	) // mismatch output
+}
+
+func TestD_SortedPairs(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+	)
+	are.NoErr(err)                            // unexpected error
+	are.Equal(nil, (&flat.D{}).SortedPairs()) // mismatch empty data
+	are.Equal("", cmp.Diff([]flat.KV{
+		{Key: "array", Value: []interface{}{json.Number("1"), json.Number("2"), json.Number("3")}},
+		{Key: "boolean", Value: true},
+		{Key: "null", Value: nil},
+		{Key: "number", Value: json.Number("123")},
+		{Key: "object_a", Value: "b"},
+		{Key: "object_e", Value: "f"},
+		{Key: "string", Value: "Hello World"},
+	}, d.SortedPairs([]string{"object", "c"}))) // mismatch pairs
+}
+
+func TestD_FlattenStrings(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			opts []flat.Settings
+			in   string
+			not  [][]string
+			out  map[string]string
+		}{
+			"Default": {},
+			"OK": {
+				in: jsonStr,
+				out: map[string]string{
+					"array":    "1|2|3",
+					"boolean":  "true",
+					"null":     "",
+					"number":   "123",
+					"object_a": "b",
+					"object_c": "d",
+					"object_e": "f",
+					"string":   "Hello World",
+				},
+			},
+			"Custom": {
+				opts: []flat.Settings{flat.NilString("NULL"), flat.XMLArray(",")},
+				in:   jsonStr,
+				not:  [][]string{{"object"}},
+				out: map[string]string{
+					"array":   "1,2,3",
+					"boolean": "true",
+					"null":    "NULL",
+					"number":  "123",
+					"string":  "Hello World",
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil, tt.opts...)
+			if tt.in != "" {
+				err := json.Unmarshal([]byte(tt.in), d)
+				are.NoErr(err) // unexpected error
+			}
+			are.Equal("", cmp.Diff(tt.out, d.FlattenStrings(tt.not...))) // mismatch data
+		})
+	}
+}
+
+func TestD_EnvMap(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"db": map[string]interface{}{
+				"host":  "x",
+				"port":  float64(5432),
+				"debug": true,
+				"pool":  map[string]interface{}{"maxSize": json.Number("10")},
+			},
+			"tags": []interface{}{"a", "b"},
+		})
+		dt = map[string]struct {
+			in     *flat.D
+			prefix string
+			out    map[string]string
+		}{
+			"Default": {},
+			"Blank":   {in: &flat.D{}, prefix: "APP"},
+			"OK": {
+				in: d,
+				out: map[string]string{
+					"DB_HOST":          "x",
+					"DB_PORT":          "5432",
+					"DB_DEBUG":         "true",
+					"DB_POOL_MAX_SIZE": "10",
+					"TAGS":             "a|b",
+				},
+			},
+			"Prefix": {
+				in:     d,
+				prefix: "app",
+				out: map[string]string{
+					"APP_DB_HOST":          "x",
+					"APP_DB_PORT":          "5432",
+					"APP_DB_DEBUG":         "true",
+					"APP_DB_POOL_MAX_SIZE": "10",
+					"APP_TAGS":             "a|b",
+				},
+			},
+			"Separated prefix": {
+				in:     flat.New(map[string]interface{}{"db": map[string]interface{}{"host": "x"}}),
+				prefix: "APP_",
+				out:    map[string]string{"APP_DB_HOST": "x"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, tt.in.EnvMap(tt.prefix))) // mismatch data
+		})
+	}
+}
+
+func TestEscapeKeySep(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"x":      map[string]interface{}{"a_b": "c", "a": map[string]interface{}{"b": "d"}},
+			"string": "Hello World",
+		}
+		dt = map[string]struct {
+			in  *flat.D
+			not [][]string
+			out map[string]interface{}
+		}{
+			"Default": {
+				in:  flat.New(in, flat.NoSimplify()),
+				out: map[string]interface{}{"x_a_b": "d", "string": "Hello World"},
+			},
+			"Ignored": {
+				in:  flat.New(in, flat.NoSimplify(), flat.EscapeKeySep()),
+				not: [][]string{{"x", "a_b"}},
+				out: map[string]interface{}{"x_a_b": "d", "string": "Hello World"},
+			},
+			"OK": {
+				in:  flat.New(in, flat.NoSimplify(), flat.EscapeKeySep()),
+				out: map[string]interface{}{"x_a__b": "c", "x_a_b": "d", "string": "Hello World"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := tt.in.Flatten(tt.not...)
+			if name == "Default" {
+				// Ambiguous keys: only one of the values is kept.
+				are.Equal(2, len(out)) // mismatch length
+				return
+			}
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+}
+
+func TestD_URLValues(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		dt  = map[string]struct {
+			in      *flat.D
+			ignored [][]string
+			out     url.Values
+		}{
+			"Default": {in: &flat.D{}},
+			"Scalar": {
+				in:      flat.New(map[string]interface{}{"a": "b", "c": float64(1), "d": true}, flat.NoSimplify()),
+				ignored: [][]string{{"d"}},
+				out:     url.Values{"a": {"b"}, "c": {"1"}},
+			},
+			"OK": {
+				in: &d,
+				out: url.Values{
+					"array":    {"1", "2", "3"},
+					"boolean":  {"true"},
+					"null":     {""},
+					"number":   {"123"},
+					"object_a": {"b"},
+					"object_c": {"d"},
+					"object_e": {"f"},
+					"string":   {"Hello World"},
+				},
+			},
+		}
+	)
+	are.NoErr(err) // unexpected error
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, tt.in.URLValues(tt.ignored...))) // mismatch data
+		})
+	}
+}
+
+func TestD_Rename(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		dt  = map[string]struct {
+			in      *flat.D
+			mapping map[string]string
+			sep     string
+			out     map[string]interface{}
+			err     error
+		}{
+			"Default": {in: &flat.D{}},
+			"OK": {
+				in:      &d,
+				mapping: map[string]string{"object_a": "alpha", "unknown": "beta"},
+				out: map[string]interface{}{
+					"array":    []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
+					"boolean":  true,
+					"null":     nil,
+					"number":   json.Number("123"),
+					"alpha":    "b",
+					"object_c": "d",
+					"object_e": "f",
+					"string":   "Hello World",
+				},
+			},
+			"Separator": {
+				in:      flat.New(map[string]interface{}{"a": map[string]interface{}{"b": "c"}, "d": "e"}, flat.NoSimplify()),
+				mapping: map[string]string{"a.b": "x"},
+				sep:     ".",
+				out:     map[string]interface{}{"x": "c", "d": "e"},
+			},
+			"Common prefix": {
+				in:      flat.New(map[string]interface{}{"db": map[string]interface{}{"host": "h", "name": "n"}}),
+				mapping: map[string]string{"db_host": "host"},
+				out:     map[string]interface{}{"host": "h", "db_name": "n"},
+			},
+			"Separator in a name": {
+				in: flat.New(map[string]interface{}{
+					"database_host": "h",
+					"db":            map[string]interface{}{"port": json.Number("1")},
+				}),
+				mapping: map[string]string{"database_host": "host", "db.port": "port"},
+				sep:     ".",
+				out:     map[string]interface{}{"host": "h", "port": json.Number("1")},
+			},
+			"Conflict": {
+				in:      &d,
+				mapping: map[string]string{"object_a": "alpha", "object_c": "alpha"},
+				err:     flat.ErrConflict,
+			},
+			"Conflict with a kept key": {
+				in:      &d,
+				mapping: map[string]string{"object_a": "string"},
+				err:     flat.ErrConflict,
+			},
+		}
+	)
+	are.NoErr(err) // unexpected error
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.Rename(tt.mapping, tt.sep)
+			are.True(errors.Is(err, tt.err))     // mismatch error
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+}
+
+func TestMergeFlat(t *testing.T) {
+	var (
+		are = is.New(t)
+		a   = map[string]interface{}{"a": "1", "b": "1"}
+		b   = map[string]interface{}{"b": "2", "c": "2"}
+		c   = map[string]interface{}{"c": "3", "d": "3"}
+		dt  = map[string]struct {
+			policy flat.ConflictPolicy
+			in     []map[string]interface{}
+			out    map[string]interface{}
+			err    error
+		}{
+			"Default": {out: map[string]interface{}{}},
+			"Single":  {in: []map[string]interface{}{a, nil}, out: a},
+			"First": {
+				policy: flat.ConflictFirst,
+				in:     []map[string]interface{}{a, b, c},
+				out:    map[string]interface{}{"a": "1", "b": "1", "c": "2", "d": "3"},
+			},
+			"Last": {
+				policy: flat.ConflictLast,
+				in:     []map[string]interface{}{a, b, c},
+				out:    map[string]interface{}{"a": "1", "b": "2", "c": "3", "d": "3"},
+			},
+			"Error": {
+				policy: flat.ConflictError,
+				in:     []map[string]interface{}{a, b, c},
+				err:    flat.ErrConflict,
+			},
+			"No conflict": {
+				policy: flat.ConflictError,
+				in:     []map[string]interface{}{a, c},
+				out:    map[string]interface{}{"a": "1", "b": "1", "c": "3", "d": "3"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := flat.MergeFlat(tt.policy, tt.in...)
+			are.True(errors.Is(err, tt.err))     // mismatch error
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+	_, err := flat.MergeFlat(flat.ConflictError, a, b)
+	are.Equal(`flat: conflicting key: "b"`, err.Error()) // mismatch message
+}
+
+func TestUnflatten(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  map[string]interface{}
+			sep string
+			out map[string]interface{}
+		}{
+			"Default": {},
+			"Blank":   {in: map[string]interface{}{}, out: map[string]interface{}{}},
+			"Conflict": {
+				in:  map[string]interface{}{"a": "b", "a_c": "d"},
+				out: map[string]interface{}{"a": map[string]interface{}{"c": "d"}},
+			},
+			"Separator": {
+				in:  map[string]interface{}{"db.host": "x", "db.user.login": "root"},
+				sep: ".",
+				out: map[string]interface{}{"db": map[string]interface{}{"host": "x", "user": map[string]interface{}{"login": "root"}}},
+			},
+			"OK": {
+				in: map[string]interface{}{"x_a__b": "c", "x_a_b": "d", "string": "Hello World"},
+				out: map[string]interface{}{
+					"x":      map[string]interface{}{"a_b": "c", "a": map[string]interface{}{"b": "d"}},
+					"string": "Hello World",
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, flat.Unflatten(tt.in, tt.sep))) // mismatch data
+		})
+	}
+}
+
+func TestUnflatten2(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"x":      map[string]interface{}{"a_b": "c", "a": map[string]interface{}{"b": "d"}},
+			"string": "Hello World",
+		}
+		out = flat.Unflatten(flat.New(in, flat.NoSimplify(), flat.EscapeKeySep()).Flatten(), "")
+	)
+	are.Equal("", cmp.Diff(in, out)) // mismatch round trip
+}
+
+func TestKeyFunc(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"object": map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": "e"}},
+			"string": "Hello World",
+		}
+		dt = map[string]struct {
+			fn  func(parts []string) string
+			not [][]string
+			out map[string]interface{}
+		}{
+			"Default": {out: map[string]interface{}{"object_a": "b", "object_c_d": "e", "string": "Hello World"}},
+			"Identity": {
+				fn: func(parts []string) string {
+					return strings.Join(parts, ".")
+				},
+				out: map[string]interface{}{"object.a": "b", "object.c.d": "e", "string": "Hello World"},
+			},
+			"Camel case": {
+				fn: func(parts []string) string {
+					return naming.CamelCase(strings.Join(parts, " "))
+				},
+				not: [][]string{{"object", "c"}},
+				out: map[string]interface{}{"objectA": "b", "string": "Hello World"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := flat.New(in, flat.KeyFunc(tt.fn)).Flatten(tt.not...)
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+}
+
+func TestNoSimplify(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"geek": map[string]interface{}{"name": "value", "age": float64(42)},
+		}
+		dt = map[string]struct {
+			in  *flat.D
+			out map[string]interface{}
+		}{
+			"Default": {in: flat.New(in), out: map[string]interface{}{"name": "value", "age": float64(42)}},
+			"OK": {
+				in:  flat.New(in, flat.NoSimplify()),
+				out: map[string]interface{}{"geek_name": "value", "geek_age": float64(42)},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, tt.in.Flatten())) // mismatch data
+		})
+	}
+}
+
+func TestD_Range(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"geek": map[string]interface{}{
+				"name": "value",
+				"age":  float64(42),
+				"city": map[string]interface{}{"name": "Paris"},
+			},
+		})
+		o = flat.New(map[string]interface{}{
+			"geek": map[string]interface{}{"name": "value", "age": nil},
+		}, flat.OmitNil(), flat.Prefix("app"), flat.KeyCase(flat.KeyUpper))
+		dt = map[string]struct {
+			in  *flat.D
+			not [][]string
+			out map[string]interface{}
+		}{
+			"Default": {out: map[string]interface{}{}},
+			"Blank":   {in: &flat.D{}, out: map[string]interface{}{}},
+			"Ignored": {
+				in:  d,
+				not: [][]string{{"geek", "city"}},
+				out: map[string]interface{}{"geek_name": "value", "geek_age": float64(42)},
+			},
+			"OK": {
+				in: d,
+				out: map[string]interface{}{
+					"geek_name":      "value",
+					"geek_age":       float64(42),
+					"geek_city_name": "Paris",
+				},
+			},
+			"Settings": {
+				in:  o,
+				out: map[string]interface{}{"APP_GEEK_NAME": "value"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := make(map[string]interface{})
+			tt.in.Range(func(key string, value interface{}) bool {
+				out[key] = value
+				return true
+			}, tt.not...)
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+}
+
+func TestD_Range2(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"a": "b",
+			"c": map[string]interface{}{"d": "e", "f": "g"},
+			"h": "i",
+		})
+		n int
+	)
+	d.Range(func(key string, value interface{}) bool {
+		n++
+		return n < 2
+	})
+	are.Equal(2, n) // unexpected number of calls
+}
+
+func TestErrCycle(t *testing.T) {
+	var (
+		are = is.New(t)
+		m   = map[string]interface{}{"a": "b"}
+		a   = []interface{}{"c", nil}
+		dt  = map[string]struct {
+			in, out map[string]interface{}
+			size    int
+		}{
+			"Map":   {in: m, out: map[string]interface{}{"a": "b"}, size: 1},
+			"Array": {in: map[string]interface{}{"a": "b", "self": a}, out: map[string]interface{}{"a": "b", "self_0": "c"}, size: 2},
+		}
+	)
+	m["self"] = m
+	a[1] = a
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(tt.in, flat.FlattenArrays())
+			are.Equal("", cmp.Diff(tt.out, d.Flatten()))                      // mismatch flattened data
+			are.True(errors.Is(d.XMLEncode(&bytes.Buffer{}), flat.ErrCycle))  // mismatch XML error
+			are.True(errors.Is(d.JSONEncode(&bytes.Buffer{}), flat.ErrCycle)) // mismatch JSON error
+			are.True(errors.Is(d.YAMLEncode(&bytes.Buffer{}), flat.ErrCycle)) // mismatch YAML error
+			_, err := d.FlattenJSON()
+			are.True(errors.Is(err, flat.ErrCycle)) // mismatch flatten error
+			err = d.Walk(func([]string, interface{}) error { return nil })
+			are.True(errors.Is(err, flat.ErrCycle))                        // mismatch walk error
+			are.Equal(tt.size, d.DeepLen())                                // mismatch deep length
+			are.Equal("", cmp.Diff(tt.out, d.Clone().Flatten()))           // mismatch cloned data
+			are.True(d.Equal(d))                                           // mismatch equality
+			are.True(errors.Is(d.ApplyPatch([]byte(`[]`)), flat.ErrCycle)) // mismatch patch error
+			are.Equal(1, d.Filter([]string{"self"}).DeepLen())             // mismatch filtered data
+			d.Normalize()
+			are.Equal("", cmp.Diff(tt.out, d.Flatten())) // mismatch normalized data
+			d.Redact("*", []string{"self"})
+			are.Equal(len(tt.in), d.Len()) // mismatch redacted data
+		})
+	}
+}
+
+func TestD_Walk(t *testing.T) {
+	var (
+		are  = is.New(t)
+		d    = flat.D{}
+		err  = json.Unmarshal([]byte(jsonStr), &d)
+		list [][]string
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	err = d.Walk(func(path []string, value interface{}) error {
+		list = append(list, path)
+		return nil
+	})
+	are.NoErr(err) // unexpected walk error
+	are.Equal("", cmp.Diff([][]string{
+		{"array"},
+		{"boolean"},
+		{"null"},
+		{"number"},
+		{"object", "a"},
+		{"object", "c"},
+		{"object", "e"},
+		{"string"},
+	}, list)) // mismatch paths
+}
+
+func TestD_Walk2(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"Geek": map[string]interface{}{"Cities": []interface{}{"Paris", map[string]interface{}{"Zip": "75001"}}},
+			"Name": "value",
+		}, flat.FlattenArrays())
+		errStop = errors.New("stop")
+		list    [][]string
+	)
+	err := d.Walk(func(path []string, value interface{}) error {
+		list = append(list, path)
+		return nil
+	})
+	are.NoErr(err) // unexpected walk error
+	are.Equal("", cmp.Diff([][]string{
+		{"Geek", "Cities", "0"},
+		{"Geek", "Cities", "1", "Zip"},
+		{"Name"},
+	}, list)) // mismatch paths
+	err = d.Walk(func(path []string, value interface{}) error {
+		return errStop
+	})
+	are.True(errors.Is(err, errStop))   // mismatch error
+	are.NoErr((*flat.D)(nil).Walk(nil)) // unexpected error on nil
+}
+
+func TestD_ValidateNoUnknown(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"db": map[string]interface{}{
+				"databse_host": "localhost",
+				"name":         "database",
+				"user": map[string]interface{}{
+					"login": "root",
+					"pass":  "insecure",
+				},
+			},
+			"timeout": float64(0),
+		})
+		dt = map[string]struct {
+			in      *flat.D
+			allowed [][]string
+			msg     string
+			err     error
+		}{
+			"Default": {},
+			"Blank":   {in: &flat.D{}, allowed: [][]string{{"db"}}},
+			"Subtree": {in: d, allowed: [][]string{{"db"}, {"timeout"}}},
+			"Unknown": {
+				in:      d,
+				allowed: [][]string{{"db", "host"}, {"db", "name"}, {"db", "user", "login"}, {"timeout"}},
+				msg:     "flat: unknown key: db_databse_host, db_user_pass",
+				err:     flat.ErrUnknownKey,
+			},
+			"OK": {
+				in:      d,
+				allowed: [][]string{{"db", "databse_host"}, {"db", "name"}, {"db", "user"}, {"timeout"}},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := tt.in.ValidateNoUnknown(tt.allowed...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.err != nil {
+				are.Equal(tt.msg, err.Error()) // mismatch message
+			}
+		})
+	}
+}
+
+func TestD_Keys(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  *flat.D
+			out []string
+		}{
+			"Default": {out: []string{}},
+			"Blank":   {in: &flat.D{}, out: []string{}},
+			"OK": {
+				in: flat.New(map[string]interface{}{
+					"string":  "Hello World",
+					"array":   []interface{}{"a"},
+					"object":  map[string]interface{}{"a": "b"},
+					"boolean": true,
+				}),
+				out: []string{"array", "boolean", "object", "string"},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, tt.in.Keys()) // mismatch keys
+		})
+	}
+}
+
+func TestD_Len(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		dt  = map[string]struct {
+			in   *flat.D
+			len  int
+			deep int
+		}{
+			"Default": {},
+			"Blank":   {in: &flat.D{}},
+			"Arrays":  {in: flat.New(d.D, flat.FlattenArrays()), len: 6, deep: 10},
+			"OK":      {in: &d, len: 6, deep: 8},
+		}
+	)
+	are.NoErr(err) // unexpected error
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.len, tt.in.Len())      // mismatch length
+			are.Equal(tt.deep, tt.in.DeepLen()) // mismatch deep length
+		})
+	}
+}
+
+func TestD_TypeCounts(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		dt  = map[string]struct {
+			in  *flat.D
+			out map[string]int
+		}{
+			"Default": {out: map[string]int{}},
+			"Blank":   {in: &flat.D{}, out: map[string]int{}},
+			"Arrays": {
+				in:  flat.New(d.D, flat.FlattenArrays()),
+				out: map[string]int{"array": 1, "bool": 1, "null": 1, "number": 4, "object": 1, "string": 4},
+			},
+			"OK": {
+				in:  &d,
+				out: map[string]int{"array": 1, "bool": 1, "null": 1, "number": 1, "object": 1, "string": 4},
+			},
+		}
+	)
+	are.NoErr(err) // unexpected error
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, tt.in.TypeCounts())) // mismatch counts
+		})
+	}
+}
+
+func TestD_Lookup(t *testing.T) {
+	var (
+		d = map[string]interface{}{
+			"array": []interface{}{
+				json.Number("1"),
+				json.Number("2"),
+				map[string]interface{}{"c": "d"},
+			},
+			"object": map[string]interface{}{
+				"a": "b",
+			},
+		}
+		are = is.New(t)
+		dt  = map[string]struct {
+			in   *flat.D
+			keys []string
+			out  interface{}
+			err  error
+		}{
+			"Default":       {err: flat.ErrNotFound},
+			"Blank":         {in: &flat.D{}, err: flat.ErrNotFound},
+			"Unknown group": {in: flat.New(d), keys: []string{"object", "a", "b"}, err: flat.ErrNotFound},
+			"Unknown value": {in: flat.New(d), keys: []string{"object", "b"}, err: flat.ErrNotFound},
+			"Index":         {in: flat.New(d), keys: []string{"array", "1"}, out: json.Number("2")},
+			"Nested index":  {in: flat.New(d), keys: []string{"array", "2", "c"}, out: "d"},
+			"Out of range":  {in: flat.New(d), keys: []string{"array", "3"}, err: flat.ErrNotFound},
+			"Not an index":  {in: flat.New(d), keys: []string{"array", "a"}, err: flat.ErrNotFound},
+			"Not an array":  {in: flat.New(d), keys: []string{"object", "a", "0"}, err: flat.ErrOutOfRange},
+			"OK":            {in: flat.New(d), keys: []string{"object", "a"}, out: "b"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.Lookup(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_LookupMany(t *testing.T) {
+	var (
+		d = flat.New(map[string]interface{}{
+			"array":  []interface{}{json.Number("1"), json.Number("2")},
+			"object": map[string]interface{}{"a": "b"},
+			"null":   nil,
+		})
+		are = is.New(t)
+		dt  = map[string]struct {
+			in    *flat.D
+			paths [][]string
+			out   []interface{}
+			err   error
+			path  string
+		}{
+			"Default": {out: []interface{}{}},
+			"Blank":   {in: &flat.D{}, paths: [][]string{{"object"}}, err: flat.ErrNotFound, path: `"object"`},
+			"Missing": {
+				in:    d,
+				paths: [][]string{{"object", "a"}, {"object", "b"}, {"oops"}},
+				err:   flat.ErrNotFound,
+				path:  `"object.b"`,
+			},
+			"OK": {
+				in:    d,
+				paths: [][]string{{"object", "a"}, {"array", "1"}, {"null"}},
+				out:   []interface{}{"b", json.Number("2"), nil},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.LookupMany(tt.paths...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+			if tt.err != nil {
+				are.True(strings.HasSuffix(err.Error(), tt.path)) // mismatch path in failure
+			}
+		})
+	}
+}
+
+func TestD_Has(t *testing.T) {
+	var (
+		d = map[string]interface{}{
+			"null": nil,
+			"object": map[string]interface{}{
+				"a": "b",
+			},
+		}
+		are = is.New(t)
+		dt  = map[string]struct {
+			in   *flat.D
+			keys []string
+			out  bool
+		}{
+			"Default":              {},
+			"Blank":                {in: &flat.D{}, keys: []string{"object"}},
+			"No key":               {in: flat.New(d)},
+			"Unknown intermediate": {in: flat.New(d), keys: []string{"oops", "a"}},
+			"Null":                 {in: flat.New(d), keys: []string{"null"}, out: true},
+			"OK":                   {in: flat.New(d), keys: []string{"object", "a"}, out: true},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, tt.in.Has(tt.keys...)) // mismatch result
+		})
+	}
+}
+
+func TestD_Normalize(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"float":  float64(1000000),
+			"int":    42,
+			"number": json.Number("1e6"),
+			"array":  []interface{}{float64(0.5), "a"},
+			"object": map[string]interface{}{"a": float64(-1.25)},
+			"inf":    math.Inf(-1),
+			"nan":    float32(math.NaN()),
+		})
+	)
+	_, err := d.String("float")
+	are.True(errors.Is(err, flat.ErrOutOfRange)) // unexpected error
+	d.Normalize()
+	nan, ok := d.D["nan"].(float32)
+	are.True(ok && math.IsNaN(float64(nan))) // mismatch NaN
+	delete(d.D, "nan")
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"float":  json.Number("1000000"),
+		"int":    json.Number("42"),
+		"number": json.Number("1e6"),
+		"array":  []interface{}{json.Number("0.5"), "a"},
+		"object": map[string]interface{}{"a": json.Number("-1.25")},
+		"inf":    math.Inf(-1),
+	}, d.D)) // mismatch data
+	are.Equal("1000000", d.ShouldString("float")) // mismatch string
+	var n *flat.D
+	n.Normalize()
+}
+
+func TestD_Redact(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = `db:
+    host: localhost
+    name: database
+    user:
+        login: root
+        pass: "insecure"
+http:
+    timeout: 0
+    hosts: [a, b]`
+		dt = map[string]struct {
+			keys [][]string
+			out  map[string]interface{}
+		}{
+			"Default": {
+				out: map[string]interface{}{
+					"db_host": "localhost", "db_name": "database", "db_user_login": "root", "db_user_pass": "insecure",
+					"http_timeout": 0, "http_hosts": []interface{}{"a", "b"},
+				},
+			},
+			"Unknown": {
+				keys: [][]string{{"db", "user", "oops"}, {"oops"}, {}},
+				out: map[string]interface{}{
+					"db_host": "localhost", "db_name": "database", "db_user_login": "root", "db_user_pass": "insecure",
+					"http_timeout": 0, "http_hosts": []interface{}{"a", "b"},
+				},
+			},
+			"Object": {
+				keys: [][]string{{"db", "user"}, {"http", "hosts", "1"}},
+				out: map[string]interface{}{
+					"db_host": "localhost", "db_name": "database", "db_user_login": "***", "db_user_pass": "***",
+					"http_timeout": 0, "http_hosts": []interface{}{"a", "***"},
+				},
+			},
+			"OK": {
+				keys: [][]string{{"db", "user", "pass"}},
+				out: map[string]interface{}{
+					"db_host": "localhost", "db_name": "database", "db_user_login": "root", "db_user_pass": "***",
+					"http_timeout": 0, "http_hosts": []interface{}{"a", "b"},
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil)
+			err := yaml.Unmarshal([]byte(in), d)
+			are.NoErr(err) // unexpected error
+			d.Redact("***", tt.keys...)
+			are.Equal("", cmp.Diff(tt.out, d.Flatten())) // mismatch data
+		})
+	}
+}
+
+func TestD_Set(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in    *flat.D
+			value interface{}
+			keys  []string
+			out   map[string]interface{}
+			err   error
+		}{
+			"Default": {err: flat.ErrNotFound},
+			"No key":  {in: &flat.D{}, value: "b", err: flat.ErrNotFound},
+			"New": {
+				in:    &flat.D{},
+				value: "b",
+				keys:  []string{"object", "a"},
+				out:   map[string]interface{}{"object": map[string]interface{}{"a": "b"}},
+			},
+			"Overwrite": {
+				in:    flat.New(map[string]interface{}{"object": map[string]interface{}{"a": "b", "c": "d"}}),
+				value: float64(42),
+				keys:  []string{"object", "a"},
+				out:   map[string]interface{}{"object": map[string]interface{}{"a": float64(42), "c": "d"}},
+			},
+			"Not an object": {
+				in:    flat.New(map[string]interface{}{"string": "Hello World"}),
+				value: "b",
+				keys:  []string{"string", "a"},
+				out:   map[string]interface{}{"string": "Hello World"},
+				err:   flat.ErrOutOfRange,
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := tt.in.Set(tt.value, tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.in != nil {
+				are.Equal("", cmp.Diff(tt.out, tt.in.D)) // mismatch data
+			}
+		})
+	}
+}
+
+func TestD_ApplyPatch(t *testing.T) {
+	const in = `{"a":{"b":"c"},"list":[1,2],"n":1}`
+	var (
+		are  = is.New(t)
+		same = map[string]interface{}{
+			"a":    map[string]interface{}{"b": "c"},
+			"list": []interface{}{json.Number("1"), json.Number("2")},
+			"n":    json.Number("1"),
+		}
+		dt = map[string]struct {
+			ops string
+			out map[string]interface{}
+			err error
+		}{
+			"Default":   {ops: `[]`, out: same},
+			"Malformed": {ops: `{"op":"add"}`, out: same, err: flat.ErrInvalidPatch},
+			"Unknown":   {ops: `[{"op":"oops","path":"/a"}]`, out: same, err: flat.ErrInvalidPatch},
+			"No value":  {ops: `[{"op":"add","path":"/x"}]`, out: same, err: flat.ErrInvalidPatch},
+			"Pointer":   {ops: `[{"op":"remove","path":"a"}]`, out: same, err: flat.ErrInvalidPointer},
+			"Missing":   {ops: `[{"op":"replace","path":"/x","value":1}]`, out: same, err: flat.ErrNotFound},
+			"Add and replace": {
+				ops: `[{"op":"add","path":"/a/d","value":{"e":true}},{"op":"replace","path":"/a/b","value":null}]`,
+				out: map[string]interface{}{
+					"a":    map[string]interface{}{"b": nil, "d": map[string]interface{}{"e": true}},
+					"list": []interface{}{json.Number("1"), json.Number("2")},
+					"n":    json.Number("1"),
+				},
+			},
+			"Arrays": {
+				ops: `[
+					{"op":"add","path":"/list/0","value":0},
+					{"op":"add","path":"/list/-","value":3},
+					{"op":"remove","path":"/list/2"},
+					{"op":"replace","path":"/list/1","value":"x"}
+				]`,
+				out: map[string]interface{}{
+					"a":    map[string]interface{}{"b": "c"},
+					"list": []interface{}{json.Number("0"), "x", json.Number("3")},
+					"n":    json.Number("1"),
+				},
+			},
+			"Move and copy": {
+				ops: `[{"op":"copy","from":"/a","path":"/z"},{"op":"move","from":"/a/b","path":"/list/1"},{"op":"remove","path":"/n"}]`,
+				out: map[string]interface{}{
+					"a":    map[string]interface{}{},
+					"list": []interface{}{json.Number("1"), "c", json.Number("2")},
+					"z":    map[string]interface{}{"b": "c"},
+				},
+			},
+			"Test and replace": {
+				ops: `[{"op":"test","path":"/list/1","value":2},{"op":"replace","path":"/list/1","value":3}]`,
+				out: map[string]interface{}{
+					"a":    map[string]interface{}{"b": "c"},
+					"list": []interface{}{json.Number("1"), json.Number("3")},
+					"n":    json.Number("1"),
+				},
+			},
+			"Test and replace with a leading zero": {
+				ops: `[{"op":"test","path":"/list/01","value":2},{"op":"replace","path":"/list/01","value":3}]`,
+				out: same,
+				err: flat.ErrNotFound,
+			},
+			"Test with a leading zero": {
+				ops: `[{"op":"test","path":"/list/01","value":2}]`,
+				out: same,
+				err: flat.ErrNotFound,
+			},
+			"Replace with a leading zero": {
+				ops: `[{"op":"replace","path":"/list/01","value":3}]`,
+				out: same,
+				err: flat.ErrNotFound,
+			},
+			"Into a child": {ops: `[{"op":"move","from":"/a","path":"/a/b"}]`, out: same, err: flat.ErrInvalidPatch},
+			"Root":         {ops: `[{"op":"replace","path":"","value":{"x":"y"}}]`, out: map[string]interface{}{"x": "y"}},
+			"Not an object": {
+				ops: `[{"op":"replace","path":"","value":[1]}]`,
+				out: same,
+				err: flat.ErrOutOfRange,
+			},
+			"Test": {
+				ops: `[{"op":"test","path":"/n","value":1.0},{"op":"test","path":"/list","value":[1,2]},{"op":"remove","path":"/a"}]`,
+				out: map[string]interface{}{
+					"list": []interface{}{json.Number("1"), json.Number("2")},
+					"n":    json.Number("1"),
+				},
+			},
+			"Failed test": {
+				ops: `[{"op":"remove","path":"/n"},{"op":"test","path":"/a/b","value":"x"}]`,
+				out: same,
+				err: flat.ErrTestFailed,
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := &flat.D{}
+			err := json.Unmarshal([]byte(in), d)
+			are.NoErr(err) // unexpected decoding error
+			err = d.ApplyPatch([]byte(tt.ops))
+			are.True(errors.Is(err, tt.err))     // mismatch error
+			are.Equal("", cmp.Diff(tt.out, d.D)) // mismatch data
+		})
+	}
+}
+
+func TestD_Lookup2(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"db": map[string]interface{}{
+				"user":  map[string]interface{}{"login": "root"},
+				"hosts": []interface{}{"a"},
+			},
+		})
+		dt = map[string]struct {
+			keys []string
+			msg  string
+			err  error
+		}{
+			"Default":      {msg: "flat: not found", err: flat.ErrNotFound},
+			"Unknown":      {keys: []string{"db", "users", "login"}, msg: `flat: not found: "db.users"`, err: flat.ErrNotFound},
+			"Out of range": {keys: []string{"db", "hosts", "1"}, msg: `flat: not found: "db.hosts.1"`, err: flat.ErrNotFound},
+			"Not an array": {
+				keys: []string{"db", "user", "login", "0"},
+				msg:  `flat: wrong data type: []interface {} expected, got string: "db.user.login.0"`,
+				err:  flat.ErrOutOfRange,
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			_, err := d.Lookup(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.msg, err.Error())   // mismatch message
+		})
+	}
+}
+
+func TestD_Get(t *testing.T) {
+	var (
+		d = flat.New(map[string]interface{}{
+			"object": map[string]interface{}{"a": "b", "null": nil},
+			"array":  []interface{}{"1", "2"},
+		})
+		are = is.New(t)
+		dt  = map[string]struct {
+			in   *flat.D
+			keys []string
+			out  interface{}
+			ok   bool
+		}{
+			"Default":      {},
+			"Present":      {in: d, keys: []string{"object", "a"}, out: "b", ok: true},
+			"Present nil":  {in: d, keys: []string{"object", "null"}, ok: true},
+			"Index":        {in: d, keys: []string{"array", "1"}, out: "2", ok: true},
+			"Missing":      {in: d, keys: []string{"object", "z"}},
+			"Out of range": {in: d, keys: []string{"array", "2"}},
+			"Scalar":       {in: d, keys: []string{"object", "a", "0"}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, ok := tt.in.Get(tt.keys...)
+			are.Equal(tt.ok, ok)   // mismatch found
+			are.Equal(tt.out, out) // mismatch data
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"object": map[string]interface{}{"enabled": true, "size": json.Number("42"), "name": "rv"},
+		})
+		obj = flat.P("object")
+		on  = obj.Add("enabled")
+	)
+	are.Equal(flat.Path{"object"}, obj)                     // unexpected change of the parent path
+	are.Equal(flat.Path{"object", "enabled"}, on)           // mismatch path
+	are.Equal(flat.Path(nil), flat.P())                     // mismatch empty path
+	are.True(d.ShouldBool(on...))                           // mismatch bool
+	are.Equal(int64(42), d.ShouldInt64(obj.Add("size")...)) // mismatch int64
+	are.Equal("rv", d.ShouldString(obj.Add("name")...))     // mismatch string
+	_, err := d.Lookup(obj.Add("missing")...)
+	are.True(errors.Is(err, flat.ErrNotFound)) // expected error
+}
+
+func TestD_LookupPath(t *testing.T) {
+	var (
+		d = flat.New(map[string]interface{}{
+			"db": map[string]interface{}{
+				"user": map[string]interface{}{"login": "root"},
+			},
+		})
+		are = is.New(t)
+		dt  = map[string]struct {
+			path, sep string
+			out       interface{}
+			err       error
+		}{
+			"Default":            {err: flat.ErrNotFound},
+			"Unknown":            {path: "db.user.pass", err: flat.ErrNotFound},
+			"Trailing separator": {path: "db.user.login.", err: flat.ErrNotFound},
+			"Custom separator":   {path: "db/user/login", sep: "/", out: "root"},
+			"OK":                 {path: "db.user.login", out: "root"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.LookupPath(tt.path, tt.sep)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_LookupPointer(t *testing.T) {
+	var (
+		in = map[string]interface{}{
+			"object": map[string]interface{}{"a": "b", "c/d": "e", "f~g": "h"},
+			"array":  []interface{}{"1", "2", "3"},
+			"":       "blank",
+		}
+		d   = flat.New(in)
+		are = is.New(t)
+		dt  = map[string]struct {
+			ptr string
+			out interface{}
+			err error
+		}{
+			"Default":        {out: in},
+			"Object":         {ptr: "/object/a", out: "b"},
+			"Array":          {ptr: "/array/1", out: "2"},
+			"Escaped slash":  {ptr: "/object/c~1d", out: "e"},
+			"Escaped tilde":  {ptr: "/object/f~0g", out: "h"},
+			"Blank key":      {ptr: "/", out: "blank"},
+			"Unknown":        {ptr: "/object/z", err: flat.ErrNotFound},
+			"Out of range":   {ptr: "/array/3", err: flat.ErrNotFound},
+			"Leading zero":   {ptr: "/array/01", err: flat.ErrNotFound},
+			"Signed index":   {ptr: "/array/+1", err: flat.ErrNotFound},
+			"Past the end":   {ptr: "/array/-", err: flat.ErrNotFound},
+			"Missing slash":  {ptr: "object", err: flat.ErrInvalidPointer},
+			"Invalid escape": {ptr: "/object/c~2d", err: flat.ErrInvalidPointer},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.LookupPointer(tt.ptr)
+			are.True(errors.Is(err, tt.err))     // unexpected error
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch data
+		})
+	}
+}
+
+func TestD_JSONSchema(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.D{}
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		str = map[string]interface{}{"type": "string"}
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"array":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "number"}},
+			"boolean": map[string]interface{}{"type": "boolean"},
+			"null":    map[string]interface{}{"type": "null"},
+			"number":  map[string]interface{}{"type": "number"},
+			"object": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"a": str, "c": str, "e": str},
+			},
+			"string": str,
+		},
+	}, d.JSONSchema())) // mismatch schema
+	d = *flat.New(map[string]interface{}{"mixed": []interface{}{"a", float64(1)}, "empty": []interface{}{}})
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"mixed": map[string]interface{}{"type": "array"},
+			"empty": map[string]interface{}{"type": "array"},
+		},
+	}, d.JSONSchema())) // mismatch arrays schema
+	are.Equal(nil, (&flat.D{}).JSONSchema()) // unexpected schema
+}
+
+func TestD_JSONEncode(t *testing.T) {
+	var (
+		are = is.New(t)
+		buf = bytes.Buffer{}
+		err = flat.New(nil).JSONEncode(&buf)
+	)
+	are.NoErr(err)                    // unexpected error
+	are.Equal("null\n", buf.String()) // mismatch value
+}
+
+func TestD_Dump(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+	)
+	are.NoErr(err) // unexpected error
+	out := d.Dump()
+	are.True(json.Valid([]byte(out)))                         // invalid JSON
+	are.True(strings.Contains(out, "\n  \"number\": 123,\n")) // mismatch indentation
+	var res flat.D
+	err = json.Unmarshal([]byte(out), &res)
+	are.NoErr(err)          // unexpected decoding error
+	are.True(d.Equal(&res)) // mismatch data
+
+	var nilD *flat.D
+	are.Equal("null", nilD.Dump())                                                    // mismatch nil data
+	are.Equal("map[a:NaN]", flat.New(map[string]interface{}{"a": math.NaN()}).Dump()) // mismatch fallback
+	cyclic := map[string]interface{}{}
+	cyclic["a"] = cyclic
+	are.Equal(flat.ErrCycle.Error(), flat.New(cyclic).Dump()) // mismatch cycle
+}
+
+func TestD_JSONEncodeOrdered(t *testing.T) {
+	const in = `{"z":1,"b":{"y":"a&b","x":null,"e":{}},"a":[{"d":2,"c":3}],"m":true}`
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			opts  []flat.Settings
+			add   bool
+			clone bool
+			out   string
+		}{
+			"Default": {
+				out: `{"a":[{"c":3,"d":2}],"b":{"e":{},"x":null,"y":"a\u0026b"},"m":true,"z":1}` + "\n",
+			},
+			"Ordered": {
+				opts: []flat.Settings{flat.JSONKeepOrder()},
+				out:  `{"z":1,"b":{"y":"a\u0026b","x":null,"e":{}},"a":[{"d":2,"c":3}],"m":true}` + "\n",
+			},
+			"Added": {
+				opts: []flat.Settings{flat.JSONKeepOrder(), flat.JSONEscapeHTML(false)},
+				add:  true,
+				out:  `{"z":1,"b":{"y":"a&b","x":null,"e":{}},"a":[{"d":2,"c":3}],"m":true,"f":"g"}` + "\n",
+			},
+			"Cloned": {
+				opts:  []flat.Settings{flat.JSONKeepOrder()},
+				clone: true,
+				out:   `{"z":1,"b":{"y":"a\u0026b","x":null,"e":{}},"a":[{"d":2,"c":3}],"m":true}` + "\n",
+			},
+			"Omitted": {
+				opts: []flat.Settings{flat.JSONKeepOrder(), flat.OmitEmpty(), flat.OmitNil()},
+				out:  `{"z":1,"b":{"y":"a\u0026b"},"a":[{"d":2,"c":3}],"m":true}` + "\n",
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil, tt.opts...)
+			err := json.Unmarshal([]byte(in), d)
+			are.NoErr(err) // unexpected decoding error
+			if tt.add {
+				d.D["f"] = "g"
+			}
+			if tt.clone {
+				d = d.Clone()
+			}
+			buf := bytes.Buffer{}
+			err = d.JSONEncodeOrdered(&buf)
+			are.NoErr(err)                  // unexpected encoding error
+			are.Equal(tt.out, buf.String()) // mismatch value
+		})
+	}
+}
+
+func TestD_JSONEncodeIndent(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{"object": map[string]interface{}{"a": "b&c"}, "number": json.Number("1e6")}
+		dt  = map[string]struct {
+			in  *flat.D
+			out string
+		}{
+			"Default": {in: flat.New(nil), out: "null\n"},
+			"Escaped": {
+				in:  flat.New(in),
+				out: "{\n\t\"number\": 1e6,\n\t\"object\": {\n\t\t\"a\": \"b\\u0026c\"\n\t}\n}\n",
+			},
+			"OK": {
+				in:  flat.New(in, flat.JSONEscapeHTML(false)),
+				out: "{\n\t\"number\": 1e6,\n\t\"object\": {\n\t\t\"a\": \"b&c\"\n\t}\n}\n",
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := tt.in.JSONEncodeIndent(&buf, "", "\t")
+			are.NoErr(err)                  // unexpected error
+			are.Equal(tt.out, buf.String()) // mismatch value
+		})
+	}
+}
+
+func TestIntBase(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{"hex": "0x1F", "oct": "777", "dec": "42", "num": json.Number("10")}
+		dt  = map[string]struct {
+			opts []flat.Settings
+			key  string
+			out  int64
+			err  bool
+		}{
+			"Default":      {key: "dec", out: 42},
+			"Default hex":  {key: "hex", err: true},
+			"Auto hex":     {opts: []flat.Settings{flat.IntBase(0)}, key: "hex", out: 31},
+			"Auto dec":     {opts: []flat.Settings{flat.IntBase(0)}, key: "dec", out: 42},
+			"Octal":        {opts: []flat.Settings{flat.IntBase(8)}, key: "oct", out: 511},
+			"Octal number": {opts: []flat.Settings{flat.IntBase(8)}, key: "num", out: 10},
+			"Invalid base": {opts: []flat.Settings{flat.IntBase(1)}, key: "oct", out: 777},
+			"Binary":       {opts: []flat.Settings{flat.IntBase(2)}, key: "oct", err: true},
+			"Hexadecimal":  {opts: []flat.Settings{flat.IntBase(16)}, key: "dec", out: 66},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(in, tt.opts...)
+			i, err := d.Int64(tt.key)
+			are.Equal(tt.err, err != nil) // mismatch int64 error
+			are.Equal(tt.out, i)          // mismatch int64
+			u, err := d.Uint64(tt.key)
+			are.Equal(tt.err, err != nil) // mismatch uint64 error
+			are.Equal(uint64(tt.out), u)  // mismatch uint64
+		})
+	}
+}
+
+func TestMaxKeyLen(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"database": map[string]interface{}{
+				"connection_timeout": "1s",
+				"connection_retries": "3",
+				"host":               "localhost",
+			},
+		}
+		dt = map[string]struct {
+			opts []flat.Settings
+			out  map[string]interface{}
+		}{
+			"Default": {
+				opts: []flat.Settings{flat.NoSimplify()},
+				out: map[string]interface{}{
+					"database_connection_timeout": "1s",
+					"database_connection_retries": "3",
+					"database_host":               "localhost",
+				},
+			},
+			"Hash": {
+				opts: []flat.Settings{flat.NoSimplify(), flat.MaxKeyLen(20)},
+				out: map[string]interface{}{
+					"database_connection_": "3",
+					"database_co_b47e8408": "1s",
+					"database_host":        "localhost",
+				},
+			},
+			"Resolver": {
+				opts: []flat.Settings{
+					flat.NoSimplify(),
+					flat.MaxKeyLen(20),
+					flat.KeyCollision(func(existing, candidate string) string {
+						return existing + "2"
+					}),
+				},
+				out: map[string]interface{}{
+					"database_connection_":  "3",
+					"database_connection_2": "1s",
+					"database_host":         "localhost",
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, flat.New(in, tt.opts...).Flatten())) // mismatch data
+		})
+	}
+}
+
+func TestMaxKeyLen2(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{"abc": "a", "abd": "b", "abe": "c"}
+		dt  = map[string]struct {
+			opts []flat.Settings
+		}{
+			"Short": {opts: []flat.Settings{flat.MaxKeyLen(2)}},
+			"Taken": {
+				opts: []flat.Settings{
+					flat.MaxKeyLen(2),
+					flat.KeyCollision(func(existing, _ string) string {
+						return existing
+					}),
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := flat.New(in, tt.opts...).Flatten()
+			are.Equal(len(in), len(out)) // mismatch length
+			for k := range out {
+				are.True(len(k) <= 2) // mismatch key length
+			}
+		})
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			mode  flat.NumberMode
+			array []interface{}
+			num   interface{}
+			float interface{}
+			big   interface{}
+		}{
+			"Default": {
+				array: []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
+				num:   json.Number("123"),
+				float: json.Number("3.14"),
+				big:   json.Number("12345678901234567890"),
+			},
+			"Float": {
+				mode:  flat.NumberFloat,
+				array: []interface{}{float64(1), float64(2), float64(3)},
+				num:   float64(123),
+				float: 3.14,
+				big:   float64(12345678901234567890),
+			},
+			"Auto": {
+				mode:  flat.NumberAuto,
+				array: []interface{}{int64(1), int64(2), int64(3)},
+				num:   int64(123),
+				float: 3.14,
+				big:   json.Number("12345678901234567890"),
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil, flat.Numbers(tt.mode))
+			err := json.Unmarshal([]byte(jsonStr), d)
+			are.NoErr(err) // unexpected unmarshal error
+			err = d.UnmarshalJSON([]byte(`{"array":[1,2,3],"number":123,"object":{"pi":3.14},"huge":1e400,"big":12345678901234567890}`))
+			are.NoErr(err)                                                    // unexpected decoding error
+			are.Equal("", cmp.Diff(tt.array, d.D["array"]))                   // mismatch array
+			are.Equal(tt.num, d.D["number"])                                  // mismatch number
+			are.Equal(tt.float, d.D["object"].(map[string]interface{})["pi"]) // mismatch float
+			are.Equal(json.Number("1e400"), d.D["huge"])                      // mismatch out of range number
+			are.Equal(tt.big, d.D["big"])                                     // mismatch out of range integer
+			are.Equal(int64(123), d.ShouldInt64("number"))                    // mismatch int64
+			are.Equal(float64(2), d.ShouldFloat64("array", "1"))              // mismatch float64
+		})
+	}
+}
+
+func TestOmitEmpty(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"empty":  map[string]interface{}{},
+			"nested": map[string]interface{}{"empty": map[string]interface{}{}},
+			"object": map[string]interface{}{"a": "b", "empty": map[string]interface{}{}, "null": nil},
+			"array":  []interface{}{map[string]interface{}{"empty": map[string]interface{}{}}},
+			"null":   nil,
+		}
+		dt = map[string]struct {
+			opts []flat.Settings
+			out  string
+		}{
+			"Default": {
+				out: `{"array":[{"empty":{}}],"empty":{},"nested":{"empty":{}},"null":null,"object":{"a":"b","empty":{},"null":null}}`,
+			},
+			"OK": {
+				opts: []flat.Settings{flat.OmitEmpty()},
+				out:  `{"array":[{}],"null":null,"object":{"a":"b","null":null}}`,
+			},
+			"Without nil": {
+				opts: []flat.Settings{flat.OmitEmpty(), flat.OmitNil()},
+				out:  `{"array":[{}],"object":{"a":"b"}}`,
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(in, tt.opts...)
+			b, err := json.Marshal(d)
+			are.NoErr(err)               // unexpected marshal error
+			are.Equal(tt.out, string(b)) // mismatch output
+			buf := bytes.Buffer{}
+			err = d.JSONEncode(&buf)
+			are.NoErr(err)                                           // unexpected encoding error
+			are.Equal(tt.out+"\n", buf.String())                     // mismatch encoded output
+			are.Equal(5, len(d.D))                                   // unexpected change of data
+			are.Equal(3, len(in["object"].(map[string]interface{}))) // unexpected change of object
+		})
+	}
+}
+
+func TestOmitNil(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			opts []flat.Settings
+			out  map[string]interface{}
+		}{
+			"Default": {
+				out: map[string]interface{}{
+					"array":    []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
+					"boolean":  true,
+					"null":     nil,
+					"number":   json.Number("123"),
+					"object_a": "b",
+					"object_c": "d",
+					"object_e": "f",
+					"string":   "Hello World",
+					"nils_a":   nil,
+					"nils_b":   nil,
+				},
+			},
+			"OK": {
+				opts: []flat.Settings{flat.OmitNil()},
+				out: map[string]interface{}{
+					"array":    []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
+					"boolean":  true,
+					"number":   json.Number("123"),
+					"object_a": "b",
+					"object_c": "d",
+					"object_e": "f",
+					"string":   "Hello World",
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil, tt.opts...)
+			err := json.Unmarshal([]byte(jsonStr), d)
+			are.NoErr(err) // unexpected unmarshal error
+			err = d.Set(map[string]interface{}{"a": nil, "b": nil}, "nils")
+			are.NoErr(err)                               // unexpected set error
+			are.Equal("", cmp.Diff(tt.out, d.Flatten())) // mismatch data
+		})
+	}
+	d := flat.New(map[string]interface{}{"geek": map[string]interface{}{"name": "value", "age": nil}, "x": nil}, flat.OmitNil())
+	are.Equal("", cmp.Diff(map[string]interface{}{"geek_name": "value"}, d.Flatten())) // mismatch single data
+}
+
+func TestPrefix(t *testing.T) {
+	var (
+		are  = is.New(t)
+		geek = map[string]interface{}{"geek": map[string]interface{}{"name": "value", "age": float64(42)}}
+		dt   = map[string]struct {
+			in   map[string]interface{}
+			opts []flat.Settings
+			out  map[string]interface{}
+		}{
+			"Default": {
+				in:  geek,
+				out: map[string]interface{}{"name": "value", "age": float64(42)},
+			},
+			"Simplified": {
+				in:   geek,
+				opts: []flat.Settings{flat.Prefix("Src")},
+				out:  map[string]interface{}{"src_name": "value", "src_age": float64(42)},
+			},
+			"Not simplified": {
+				in:   geek,
+				opts: []flat.Settings{flat.Prefix("src"), flat.NoSimplify()},
+				out:  map[string]interface{}{"src_geek_name": "value", "src_geek_age": float64(42)},
+			},
+			"Renamed as another key": {
+				in:   map[string]interface{}{"a": "b", "src": map[string]interface{}{"a": "c"}},
+				opts: []flat.Settings{flat.Prefix("src")},
+				out:  map[string]interface{}{"src_a": "b", "src_src_a": "c"},
+			},
+			"Key func": {
+				in: geek,
+				opts: []flat.Settings{flat.Prefix("src"), flat.KeyFunc(func(parts []string) string {
+					return strings.Join(parts, ".")
+				})},
+				out: map[string]interface{}{"src.geek.name": "value", "src.geek.age": float64(42)},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal("", cmp.Diff(tt.out, flat.New(tt.in, tt.opts...).Flatten())) // mismatch data
+		})
+	}
+	d := flat.New(nil, flat.Prefix("src"))
+	err := json.Unmarshal([]byte(jsonStr), d)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"src_array":    []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
+		"src_boolean":  true,
+		"src_null":     nil,
+		"src_number":   json.Number("123"),
+		"src_object_a": "b",
+		"src_object_c": "d",
+		"src_object_e": "f",
+		"src_string":   "Hello World",
+	}, d.Flatten())) // mismatch sample data
+}
+
+func TestRequire(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in   string
+			opts []flat.Settings
+			err  string
+		}{
+			"Default": {in: `{"a":1}`},
+			"OK": {
+				in:   `{"db":{"host":"localhost","port":null}}`,
+				opts: []flat.Settings{flat.Require([]string{"db", "host"}, []string{"db", "port"})},
+			},
+			"Missing": {
+				in:   `{"db":{"host":"localhost"}}`,
+				opts: []flat.Settings{flat.Require([]string{"db", "host"}, []string{"db", "user", "login"})},
+				err:  "flat: missing required key: db.user.login",
+			},
+			"Several": {
+				in:   `{"name":"rv"}`,
+				opts: []flat.Settings{flat.Require([]string{"db", "host"}), flat.Require([]string{"db", "port"})},
+				err:  "flat: missing required key: db.host, db.port",
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := json.Unmarshal([]byte(tt.in), flat.New(nil, tt.opts...))
+			if tt.err == "" {
+				are.NoErr(err) // unexpected error
+				return
+			}
+			are.True(errors.Is(err, flat.ErrMissingRequired)) // mismatch error
+			are.Equal(tt.err, err.Error())                    // mismatch message
+		})
+	}
+	d := flat.New(map[string]interface{}{"a": "b"}, flat.Require([]string{"a"}, []string{"c"}))
+	are.True(errors.Is(d.Validate(), flat.ErrMissingRequired)) // expected validation error
+	d = flat.New(map[string]interface{}{"keep": json.Number("1")}, flat.Require([]string{"c"}))
+	err := d.UnmarshalJSON([]byte(`{"x":1}`))
+	are.True(errors.Is(err, flat.ErrMissingRequired))                              // expected decoding error
+	are.Equal("", cmp.Diff(map[string]interface{}{"keep": json.Number("1")}, d.D)) // mismatch unchanged data
+}
+
+func TestStrict(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"str":    "3.14",
+			"num":    json.Number("3.14"),
+			"float":  3.14,
+			"bool":   "true",
+			"array":  []interface{}{float64(1), "2"},
+			"string": "Hello World",
+		}
+		dt = map[string]struct {
+			opts []flat.Settings
+			key  string
 			err  error
 		}{
-			"Default":       {err: flat.ErrNotFound},
-			"Blank":         {in: &flat.D{}, err: flat.ErrNotFound},
-			"Unknown group": {in: flat.New(d), keys: []string{"object", "a", "b"}, err: flat.ErrNotFound},
-			"Unknown value": {in: flat.New(d), keys: []string{"object", "b"}, err: flat.ErrNotFound},
-			"OK":            {in: flat.New(d), keys: []string{"object", "a"}, out: "b"},
+			"Default string":   {key: "str"},
+			"Default number":   {key: "num"},
+			"Default float":    {key: "float"},
+			"Strict string":    {opts: []flat.Settings{flat.Strict()}, key: "str", err: flat.ErrOutOfRange},
+			"Strict number":    {opts: []flat.Settings{flat.Strict()}, key: "num"},
+			"Strict float":     {opts: []flat.Settings{flat.Strict()}, key: "float"},
+			"Strict not found": {opts: []flat.Settings{flat.Strict()}, key: "missing", err: flat.ErrNotFound},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			out, err := tt.in.Lookup(tt.keys...)
-			are.True(errors.Is(err, tt.err)) // unexpected error
-			are.Equal(tt.out, out)           // mismatch data
+			d := flat.New(in, tt.opts...)
+			f, err := d.Float64(tt.key)
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			if tt.err == nil {
+				are.Equal(3.14, f) // mismatch value
+			}
+			_, err = flat.Get[float64](d, tt.key)
+			are.True(errors.Is(err, tt.err)) // mismatch generic error
 		})
 	}
+	d := flat.New(in, flat.Strict())
+	_, err := d.Bool("bool")
+	are.True(errors.Is(err, flat.ErrOutOfRange)) // mismatch bool error
+	_, err = d.Int64s("array")
+	are.True(errors.Is(err, flat.ErrOutOfRange)) // mismatch array error
+	v, err := d.String("string")
+	are.NoErr(err)              // unexpected string error
+	are.Equal("Hello World", v) // mismatch string
+	b, err := flat.New(in).Bool("bool")
+	are.NoErr(err) // unexpected lenient bool error
+	are.True(b)    // mismatch lenient bool
 }
 
-func TestD_JSONEncode(t *testing.T) {
+func TestJSONEscapeHTML(t *testing.T) {
 	var (
 		are = is.New(t)
 		buf = bytes.Buffer{}
-		err = flat.New(nil).JSONEncode(&buf)
+		err = flat.New(map[string]interface{}{"a": "<b>&</b>"}, flat.JSONEscapeHTML(false)).JSONEncode(&buf)
 	)
-	are.NoErr(err)                    // unexpected error
-	are.Equal("null\n", buf.String()) // mismatch value
+	are.NoErr(err)                                   // unexpected error
+	are.Equal(`{"a":"<b>&</b>"}`+"\n", buf.String()) // mismatch value
 }
 
 func TestD_MarshalJSON(t *testing.T) {
@@ -203,6 +2705,167 @@ func TestD_UnmarshalJSON2(t *testing.T) {
 	are.Equal(nil, d.Flatten()) // mismatch value
 }
 
+func TestD_UnmarshalJSON3(t *testing.T) {
+	var (
+		are = is.New(t)
+		old = map[string]interface{}{"old": json.Number("1")}
+		res = map[string]interface{}{"a": json.Number("1"), "old": json.Number("1")}
+		dt  = map[string]struct {
+			in  string
+			out map[string]interface{}
+			err error
+		}{
+			"Clean":               {in: `{"a":1}`, out: res},
+			"Trailing whitespace": {in: "{\"a\":1} \n\t", out: res},
+			"Trailing object":     {in: `{"a":1}{"b":2}`, out: old, err: flat.ErrTrailingData},
+			"Trailing garbage":    {in: `{"a":1}oops`, out: old, err: flat.ErrTrailingData},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(map[string]interface{}{"old": json.Number("1")})
+			err := d.UnmarshalJSON([]byte(tt.in))
+			are.True(errors.Is(err, tt.err))     // unexpected error
+			are.Equal("", cmp.Diff(tt.out, d.D)) // mismatch data
+		})
+	}
+}
+
+func TestD_ToStruct(t *testing.T) {
+	type object struct {
+		A string `json:"a"`
+		C string `json:"c"`
+	}
+	type sample struct {
+		Array   []int       `json:"array"`
+		Boolean bool        `json:"boolean"`
+		Null    *string     `json:"null"`
+		Number  json.Number `json:"number"`
+		Object  object      `json:"object"`
+		String  string      `json:"string"`
+		Any     interface{} `json:"any"`
+	}
+	var (
+		are = is.New(t)
+		d   = flat.D{}
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		out sample
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	err = d.Set(float64(42), "any")
+	are.NoErr(err) // unexpected set error
+	err = d.ToStruct(&out)
+	are.NoErr(err) // unexpected error
+	are.Equal("", cmp.Diff(sample{
+		Array:   []int{1, 2, 3},
+		Boolean: true,
+		Number:  json.Number("123"),
+		Object:  object{A: "b", C: "d"},
+		String:  "Hello World",
+		Any:     json.Number("42"),
+	}, out)) // mismatch data
+	err = d.ToStruct(out)
+	are.True(errors.Is(err, flat.ErrInvalidTarget)) // expected error with a value
+	err = d.ToStruct((*sample)(nil))
+	are.True(errors.Is(err, flat.ErrInvalidTarget)) // expected error with a nil pointer
+	err = d.ToStruct(nil)
+	are.True(errors.Is(err, flat.ErrInvalidTarget)) // expected error without target
+}
+
+func TestD_Scan(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out map[string]interface{}
+			err error
+		}{
+			"Default": {},
+			"Bytes":   {in: []byte(`{"a":{"b":1}}`), out: map[string]interface{}{"a": map[string]interface{}{"b": json.Number("1")}}},
+			"String":  {in: `{"a":"b"}`, out: map[string]interface{}{"a": "b"}},
+			"Invalid": {in: 42, err: flat.ErrOutOfRange},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(map[string]interface{}{"c": "d"})
+			err := d.Scan(tt.in)
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			if tt.err != nil {
+				return
+			}
+			are.Equal("", cmp.Diff(tt.out, d.D)) // mismatch data
+			v, err := d.Value()
+			are.NoErr(err) // unexpected value error
+			d2 := flat.D{}
+			err = d2.Scan(v)
+			are.NoErr(err)                        // unexpected round trip error
+			are.Equal("", cmp.Diff(tt.out, d2.D)) // mismatch round trip
+		})
+	}
+}
+
+func TestD_Value(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   *flat.D
+	)
+	v, err := d.Value()
+	are.NoErr(err)    // unexpected error on nil
+	are.Equal(nil, v) // mismatch value on nil
+	v, err = flat.New(map[string]interface{}{"a": "b"}).Value()
+	are.NoErr(err)                             // unexpected error
+	are.Equal([]byte(`{"a":"b"}`), v.([]byte)) // mismatch value
+}
+
+func TestD_Nil(t *testing.T) {
+	var (
+		are = is.New(t)
+		buf = &bytes.Buffer{}
+		d   *flat.D
+	)
+	_, err := d.Bool("x")
+	are.True(errors.Is(err, flat.ErrNotFound)) // mismatch bool error
+	_, err = d.Lookup("x")
+	are.True(errors.Is(err, flat.ErrNotFound)) // mismatch lookup error
+	are.Equal(nil, d.Flatten())                // mismatch flatten
+	are.Equal(0, len(d.FlattenStrings()))      // mismatch flatten strings
+	are.Equal(0, len(d.SortedPairs()))         // mismatch sorted pairs
+	are.Equal(0, len(d.URLValues()))           // mismatch URL values
+	_, err = d.GobEncode()
+	are.NoErr(err) // unexpected gob error
+	err = d.JSONEncode(buf)
+	are.NoErr(err)                    // unexpected JSON error
+	are.Equal("null\n", buf.String()) // mismatch JSON
+	buf.Reset()
+	err = d.XMLEncode(buf)
+	are.NoErr(err)              // unexpected XML error
+	are.Equal("", buf.String()) // mismatch XML
+	buf.Reset()
+	err = d.YAMLEncode(buf)
+	are.NoErr(err) // unexpected YAML error
+	err = d.UnmarshalJSON([]byte(`{"a":"b"}`))
+	are.True(errors.Is(err, flat.ErrInvalidTarget)) // mismatch unmarshal error
+}
+
+func TestD_GobEncode(t *testing.T) {
+	var (
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(jsonStr), &d)
+		buf = &bytes.Buffer{}
+	)
+	are.NoErr(err) // unexpected error
+	err = gob.NewEncoder(buf).Encode(&d)
+	are.NoErr(err) // unexpected encoding error
+	var res flat.D
+	err = gob.NewDecoder(buf).Decode(&res)
+	are.NoErr(err)          // unexpected decoding error
+	are.True(d.Equal(&res)) // mismatch data
+}
+
 func TestD_XMLEncode(t *testing.T) {
 	var (
 		are = is.New(t)
@@ -223,6 +2886,75 @@ func TestD_MarshalXML(t *testing.T) {
 	are.Equal("", string(b)) // mismatch value
 }
 
+func TestD_MarshalXML2(t *testing.T) {
+	var (
+		are    = is.New(t)
+		d      = flat.New(map[string]interface{}{"int": 42})
+		b, err = xml.Marshal(d)
+	)
+	are.NoErr(err)                               // unexpected error
+	are.Equal("<d><int>42</int></d>", string(b)) // mismatch value
+}
+
+func TestD_MarshalXML3(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out string
+		}{
+			"Escaped": {in: "<b>&</b>", out: "<d><v>&lt;b&gt;&amp;&lt;/b&gt;</v></d>"},
+			"CDATA":   {in: flat.CDATA("<b>&</b>"), out: "<d><v><![CDATA[<b>&</b>]]></v></d>"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			b, err := xml.Marshal(flat.New(map[string]interface{}{"v": tt.in}))
+			are.NoErr(err)               // unexpected marshal error
+			are.Equal(tt.out, string(b)) // mismatch output
+			d := flat.D{}
+			err = xml.Unmarshal(b, &d)
+			are.NoErr(err)                             // unexpected unmarshal error
+			are.Equal("<b>&</b>", d.ShouldString("v")) // mismatch round trip
+		})
+	}
+}
+
+func TestD_MarshalXML4(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"c": "3",
+			"a": map[string]interface{}{"z": "26", "b": "2", "m": "13"},
+			"b": "2",
+			"d": "4",
+		})
+		exp = "<d><a><b>2</b><m>13</m><z>26</z></a><b>2</b><c>3</c><d>4</d></d>"
+	)
+	for i := 0; i < 2; i++ {
+		b, err := xml.Marshal(d)
+		are.NoErr(err)            // unexpected marshal error
+		are.Equal(exp, string(b)) // mismatch output
+	}
+}
+
+type uuid [4]byte
+
+func (u uuid) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(u[:])), nil
+}
+
+func TestD_MarshalXML5(t *testing.T) {
+	var (
+		are    = is.New(t)
+		d      = flat.New(map[string]interface{}{"id": uuid{0xde, 0xad, 0xbe, 0xef}})
+		b, err = xml.Marshal(d)
+	)
+	are.NoErr(err)                                   // unexpected error
+	are.Equal("<d><id>deadbeef</id></d>", string(b)) // mismatch value
+}
+
 func TestD_UnmarshalXML(t *testing.T) {
 	var (
 		d   = flat.D{}
@@ -234,7 +2966,7 @@ func TestD_UnmarshalXML(t *testing.T) {
 	are.Equal("", cmp.Diff(d.Flatten(), map[string]interface{}{
 		"array":      "1|2|3", // todo in the next release: []interface{}{"1","2","3"}
 		"boolean":    "true",  // todo in the next release: true
-		"null":       "\n  ",  // todo in the next release: nil
+		"null":       nil,
 		"hyp_number": "123",
 		"object_a":   "b",
 		"object_c":   "d",
@@ -243,14 +2975,384 @@ func TestD_UnmarshalXML(t *testing.T) {
 	}))
 }
 
-func TestD_YAMLEncode(t *testing.T) {
+func TestParseXML(t *testing.T) {
+	type leaf struct {
+		Path  []string
+		Value string
+	}
+	var (
+		are   = is.New(t)
+		errFn = errors.New("oops")
+		dt    = map[string]struct {
+			in     string
+			max    int
+			out    []leaf
+			err    error
+			syntax bool
+		}{
+			"Default": {},
+			"Invalid": {in: `<d><a>b</d>`, syntax: true},
+			"Stopped": {
+				in:  xmlStr,
+				max: 2,
+				out: []leaf{{Path: []string{"array"}, Value: "1|2|3"}, {Path: []string{"boolean"}, Value: "true"}},
+				err: errFn,
+			},
+			"OK": {
+				in: xmlStr,
+				out: []leaf{
+					{Path: []string{"array"}, Value: "1|2|3"},
+					{Path: []string{"boolean"}, Value: "true"},
+					{Path: []string{"null"}, Value: ""},
+					{Path: []string{"hyp:number"}, Value: "123"},
+					{Path: []string{"object", "a"}, Value: "b"},
+					{Path: []string{"object", "c"}, Value: "d"},
+					{Path: []string{"object", "e"}, Value: "f"},
+					{Path: []string{"string"}, Value: "Hello World"},
+				},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			var out []leaf
+			err := flat.ParseXML(strings.NewReader(tt.in), func(path []string, value string) error {
+				if tt.max > 0 && len(out) == tt.max {
+					return errFn
+				}
+				out = append(out, leaf{Path: path, Value: value})
+				return nil
+			})
+			if tt.syntax {
+				var e *xml.SyntaxError
+				are.True(errors.As(err, &e)) // expected syntax error
+			} else {
+				are.True(errors.Is(err, tt.err)) // mismatch error
+			}
+			are.Equal("", cmp.Diff(tt.out, out)) // mismatch leaves
+		})
+	}
+}
+
+func TestXMLTrimSpace(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = `<d><empty></empty><blank>  </blank><text> a </text><node><a>b</a></node></d>`
+		dt  = map[string]struct {
+			opts []flat.Settings
+			out  map[string]interface{}
+		}{
+			"Default": {
+				out: map[string]interface{}{"empty": nil, "blank": nil, "text": " a ", "node": map[string]interface{}{"a": "b"}},
+			},
+			"Trimmed": {
+				opts: []flat.Settings{flat.XMLTrimSpace(true)},
+				out:  map[string]interface{}{"empty": nil, "blank": nil, "text": " a ", "node": map[string]interface{}{"a": "b"}},
+			},
+			"Kept": {
+				opts: []flat.Settings{flat.XMLTrimSpace(false)},
+				out:  map[string]interface{}{"empty": "", "blank": "  ", "text": " a ", "node": map[string]interface{}{"a": "b"}},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(nil, tt.opts...)
+			err := xml.Unmarshal([]byte(in), d)
+			are.NoErr(err)                       // unexpected error
+			are.Equal("", cmp.Diff(tt.out, d.D)) // mismatch data
+		})
+	}
+}
+
+func TestXMLTrimValues(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{
+			"a":     "  hi  ",
+			"cdata": flat.CDATA(" x "),
+			"node":  map[string]interface{}{"@id": " 1 ", flat.XMLTextKey: " text "},
+		}
+		dt = map[string]struct {
+			opts []flat.Settings
+			out  string
+		}{
+			"Default": {
+				out: `<d><a>  hi  </a><cdata><![CDATA[ x ]]></cdata><node id=" 1 "> text </node></d>`,
+			},
+			"Untrimmed": {
+				opts: []flat.Settings{flat.XMLTrimValues(false)},
+				out:  `<d><a>  hi  </a><cdata><![CDATA[ x ]]></cdata><node id=" 1 "> text </node></d>`,
+			},
+			"Trimmed": {
+				opts: []flat.Settings{flat.XMLTrimValues(true)},
+				out:  `<d><a>hi</a><cdata><![CDATA[ x ]]></cdata><node id=" 1 ">text</node></d>`,
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(in, append(tt.opts, flat.XMLName("d"), flat.XMLAttrPrefix("@"))...)
+			b, err := xml.Marshal(d)
+			are.NoErr(err)               // unexpected error
+			are.Equal(tt.out, string(b)) // mismatch data
+		})
+	}
+}
+
+func TestXMLAttrPrefix(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(nil, flat.XMLAttrPrefix("@"))
+		in  = `<d xmlns:hyp="hyp"><node id="1" hyp:lang="en">text</node><empty id="2"/><string>Hello World</string></d>`
+		err = xml.Unmarshal([]byte(in), d)
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"node":   map[string]interface{}{"@id": "1", "@hyp:lang": "en", flat.XMLTextKey: "text"},
+		"empty":  map[string]interface{}{"@id": "2"},
+		"string": "Hello World",
+	}, d.D)) // mismatch data
+	d = d.Clone()
+	delete(d.D, "string")
+	delete(d.D, "empty")
+	b, err := xml.Marshal(d)
+	are.NoErr(err)                                                        // unexpected marshal error
+	are.Equal(`<d><node hyp:lang="en" id="1">text</node></d>`, string(b)) // mismatch output
+}
+
+func TestTimeLayout(t *testing.T) {
+	var (
+		are = is.New(t)
+		now = time.Date(2021, 9, 18, 11, 30, 0, 0, time.UTC)
+		dt  = map[string]struct {
+			opts []flat.Settings
+			out  string
+		}{
+			"Default": {out: "2021-09-18T11:30:00Z"},
+			"Custom":  {opts: []flat.Settings{flat.TimeLayout(time.RFC1123)}, out: "Sat, 18 Sep 2021 11:30:00 UTC"},
+			"Blank":   {opts: []flat.Settings{flat.TimeLayout("")}, out: "2021-09-18T11:30:00Z"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			d := flat.New(map[string]interface{}{"at": now}, tt.opts...)
+			b, err := xml.Marshal(d)
+			are.NoErr(err)                                     // unexpected marshal error
+			are.Equal("<d><at>"+tt.out+"</at></d>", string(b)) // mismatch XML output
+			s, err := d.String("at")
+			are.NoErr(err)       // unexpected string error
+			are.Equal(tt.out, s) // mismatch string
+			v, err := d.Time("", "at")
+			are.NoErr(err)         // unexpected time error
+			are.True(now.Equal(v)) // mismatch time
+		})
+	}
+}
+
+func TestXMLArrayElement(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  map[string]interface{}
+			xml string
+		}{
+			"Scalars": {
+				in:  map[string]interface{}{"array": []interface{}{"1", "2", "3"}, "string": "Hello World"},
+				xml: "<d><array><item>1</item><item>2</item><item>3</item></array><string>Hello World</string></d>",
+			},
+			"Single": {
+				in:  map[string]interface{}{"array": []interface{}{"1"}},
+				xml: "<d><array><item>1</item></array></d>",
+			},
+			"Objects": {
+				in: map[string]interface{}{"array": []interface{}{
+					map[string]interface{}{"a": "b"},
+					map[string]interface{}{"c": "d"},
+				}},
+				xml: "<d><array><item><a>b</a></item><item><c>d</c></item></array></d>",
+			},
+			"Nested": {
+				in:  map[string]interface{}{"array": []interface{}{[]interface{}{"1", "2"}, "3"}},
+				xml: "<d><array><item><item>1</item><item>2</item></item><item>3</item></array></d>",
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			b, err := xml.Marshal(flat.New(tt.in, flat.XMLArrayElement("item")))
+			are.NoErr(err)               // unexpected marshal error
+			are.Equal(tt.xml, string(b)) // mismatch output
+			d := flat.New(nil, flat.XMLArrayElement("item"))
+			err = xml.Unmarshal(b, d)
+			are.NoErr(err)                      // unexpected unmarshal error
+			are.Equal("", cmp.Diff(tt.in, d.D)) // mismatch round trip
+		})
+	}
+	d := flat.New(nil, flat.XMLArrayElement("item"))
+	err := xml.Unmarshal([]byte("<d><mixed><item>1</item><other>2</other></mixed></d>"), d)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"mixed": map[string]interface{}{"item": "1", "other": "2"},
+	}, d.D)) // mismatch mixed content
+	d = flat.New(nil, flat.XMLArrayElement("item"))
+	err = xml.Unmarshal([]byte("<d><item>1</item><mixed><item>2</item><item>3</item><other>4</other></mixed></d>"), d)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"item":  "1",
+		"mixed": map[string]interface{}{"item": []interface{}{"2", "3"}, "other": "4"},
+	}, d.D)) // mismatch repeated mixed content
+}
+
+func TestXMLDecodeValues(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = `<d><url>https%3A%2F%2Fexample.com%2F%3Fq%3Da%26b</url><node><name>Hello+World</name></node></d>`
+		d   = flat.New(nil, flat.XMLDecodeValues(url.QueryUnescape))
+		err = xml.Unmarshal([]byte(in), d)
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"url":  "https://example.com/?q=a&b",
+		"node": map[string]interface{}{"name": "Hello World"},
+	}, d.D)) // mismatch data
+	err = xml.Unmarshal([]byte(`<d><url>%zz</url></d>`), d)
+	var e url.EscapeError
+	are.True(errors.As(err, &e)) // mismatch error
+	d = flat.New(nil)
+	err = xml.Unmarshal([]byte(in), d)
+	are.NoErr(err)                                                               // unexpected default error
+	are.Equal("https%3A%2F%2Fexample.com%2F%3Fq%3Da%26b", d.ShouldString("url")) // mismatch default data
+}
+
+func TestXMLInferTypes(t *testing.T) {
+	var (
+		d   = flat.New(nil, flat.XMLInferTypes())
+		are = is.New(t)
+		buf = []byte(xmlStr)
+		err = xml.Unmarshal(buf, d)
+	)
+	are.NoErr(err)
+	are.Equal("", cmp.Diff(d.Flatten(), map[string]interface{}{
+		"array":      "1|2|3",
+		"boolean":    true,
+		"null":       nil,
+		"hyp_number": json.Number("123"),
+		"object_a":   "b",
+		"object_c":   "d",
+		"object_e":   "f",
+		"string":     "Hello World",
+	}))
+}
+
+func TestXMLInferTypes2(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(nil, flat.XMLAttrPrefix("@"), flat.XMLInferTypes(), flat.Strict())
+		err = xml.Unmarshal([]byte(`<d><n id="1" on="true" name="x"/></d>`), d)
+	)
+	are.NoErr(err) // unexpected unmarshal error
+	are.Equal("", cmp.Diff(map[string]interface{}{
+		"n": map[string]interface{}{"@id": json.Number("1"), "@on": true, "@name": "x"},
+	}, d.D)) // mismatch data
+	id, err := d.Int64("n", "@id")
+	are.NoErr(err)          // unexpected int64 error
+	are.Equal(int64(1), id) // mismatch id
+}
+
+func TestXMLNilAttr(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out string
+		}{
+			"Nil":   {out: `<d xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><v xsi:nil="true"></v></d>`},
+			"Bool":  {in: true, out: `<d xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><v>true</v></d>`},
+			"Empty": {in: "", out: `<d xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><v></v></d>`},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			b, err := xml.Marshal(flat.New(map[string]interface{}{"v": tt.in}, flat.XMLNilAttr()))
+			are.NoErr(err)               // unexpected marshal error
+			are.Equal(tt.out, string(b)) // mismatch output
+		})
+	}
+	b, err := xml.Marshal(flat.New(map[string]interface{}{"v": nil}))
+	are.NoErr(err)                         // unexpected default marshal error
+	are.Equal("<d><v></v></d>", string(b)) // mismatch default output
+}
+
+func TestXMLSplitArrays(t *testing.T) {
+	var (
+		are    = is.New(t)
+		in     = map[string]interface{}{"array": []interface{}{"1", "2", "3"}, "string": "Hello World"}
+		b, err = xml.Marshal(flat.New(in))
+	)
+	are.NoErr(err) // unexpected marshal error
+	d := flat.New(nil, flat.XMLSplitArrays())
+	err = xml.Unmarshal(b, d)
+	are.NoErr(err)                   // unexpected unmarshal error
+	are.Equal("", cmp.Diff(in, d.D)) // mismatch round trip
+	d = flat.New(nil, flat.XMLSplitArrays(), flat.XMLInferTypes())
+	err = xml.Unmarshal([]byte(xmlStr), d)
+	are.NoErr(err) // unexpected unmarshal error
+	v, err := d.Int64s("array")
+	are.NoErr(err)                 // unexpected typed array error
+	are.Equal([]int64{1, 2, 3}, v) // mismatch typed array
+}
+
+func TestD_YAMLEncode(t *testing.T) {
+	var (
+		are = is.New(t)
+		buf = bytes.Buffer{}
+		err = flat.New(nil).YAMLEncode(&buf)
+	)
+	are.NoErr(err)                  // unexpected error
+	are.Equal("{}\n", buf.String()) // mismatch value
+}
+
+func TestYAMLIndent(t *testing.T) {
+	var (
+		are = is.New(t)
+		in  = map[string]interface{}{"object": map[string]interface{}{"a": "b"}}
+		dt  = map[string]struct {
+			in  *flat.D
+			out string
+		}{
+			"Default": {in: flat.New(in), out: "object:\n    a: b\n"},
+			"OK":      {in: flat.New(in, flat.YAMLIndent(2)), out: "object:\n  a: b\n"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := tt.in.YAMLEncode(&buf)
+			are.NoErr(err)                  // unexpected error
+			are.Equal(tt.out, buf.String()) // mismatch indentation
+		})
+	}
+}
+
+func TestD_MarshalYAML(t *testing.T) {
 	var (
 		are = is.New(t)
 		buf = bytes.Buffer{}
-		err = flat.New(nil).YAMLEncode(&buf)
+		d   = flat.New(map[string]interface{}{"object": map[string]interface{}{"a": "b"}, "number": 42})
 	)
-	are.NoErr(err)                  // unexpected error
-	are.Equal("{}\n", buf.String()) // mismatch value
+	b, err := yaml.Marshal(d)
+	are.NoErr(err) // unexpected marshal error
+	err = d.YAMLEncode(&buf)
+	are.NoErr(err)                     // unexpected encoding error
+	are.Equal(buf.String(), string(b)) // mismatch output
 }
 
 func TestD_UnmarshalYAML(t *testing.T) {
@@ -283,6 +3385,85 @@ func TestD_UnmarshalYAML2(t *testing.T) {
 	are.Equal(nil, d.Flatten()) // mismatch value
 }
 
+func TestD_BigFloat(t *testing.T) {
+	var (
+		n      = "123456789012345678901234567890.123456789"
+		nan, _ = flat.Decode(strings.NewReader("nan: .nan"), flat.YAML)
+		d      = flat.New(map[string]interface{}{"balance": json.Number(n), "bool": true})
+		are    = is.New(t)
+		dt     = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out string
+			err error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Blank":      {keys: []string{"balance"}, err: flat.ErrNotFound},
+			"Unknown":    {in: d, err: flat.ErrNotFound, keys: []string{"oops"}},
+			"Wrong type": {in: d, err: flat.ErrOutOfRange, keys: []string{"bool"}},
+			"NaN":        {in: nan, err: flat.ErrOutOfRange, keys: []string{"nan"}},
+			"OK":         {in: d, keys: []string{"balance"}, out: n},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.BigFloat(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			if tt.err == nil {
+				are.Equal(tt.out, out.Text('f', -1)) // mismatch value
+			}
+		})
+	}
+}
+
+func TestD_BigInt(t *testing.T) {
+	var (
+		n   = "123456789012345678901234567890"
+		d   = flat.New(map[string]interface{}{"balance": json.Number(n), "bool": true})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out string
+			err error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Blank":      {keys: []string{"balance"}, err: flat.ErrNotFound},
+			"Unknown":    {in: d, err: flat.ErrNotFound, keys: []string{"oops"}},
+			"Wrong type": {in: d, err: flat.ErrOutOfRange, keys: []string{"bool"}},
+			"OK":         {in: d, keys: []string{"balance"}, out: n},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.BigInt(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			if tt.err == nil {
+				are.Equal(tt.out, out.String()) // mismatch value
+			}
+		})
+	}
+}
+
+func TestD_BigInt2(t *testing.T) {
+	var (
+		n   = "1234567890123456789012345678901234567890"
+		d   = flat.D{}
+		are = is.New(t)
+		err = json.Unmarshal([]byte(`{"account":{"balance":`+n+`}}`), &d)
+	)
+	are.NoErr(err) // unexpected decoding error
+	out, err := flat.New(d.Flatten()).BigInt("account_balance")
+	are.NoErr(err)             // unexpected error
+	are.Equal(n, out.String()) // mismatch value
+}
+
 func TestD_Bool(t *testing.T) {
 	var (
 		d   = flat.New(map[string]interface{}{"bool": true})
@@ -337,6 +3518,180 @@ func TestD_ShouldBool(t *testing.T) {
 	}
 }
 
+func TestD_BoolOr(t *testing.T) {
+	var (
+		d   = flat.New(map[string]interface{}{"bool": false, "string": "oops"})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out bool
+		}{
+			"Default":    {out: true},
+			"Unknown":    {in: d, keys: []string{"unknown"}, out: true},
+			"Wrong type": {in: d, keys: []string{"string"}, out: true},
+			"OK":         {in: d, keys: []string{"bool"}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := tt.in.BoolOr(true, tt.keys...)
+			are.Equal(tt.out, out) // mismatch value
+		})
+	}
+}
+
+func TestD_Bytes(t *testing.T) {
+	var (
+		d = flat.New(map[string]interface{}{
+			"std":  "aGk/Pz8=",
+			"raw":  "aGk/Pz8",
+			"oops": "!",
+			"bool": true,
+		})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			raw  bool
+			// outputs
+			out []byte
+			err error
+		}{
+			"Default":     {err: flat.ErrNotFound},
+			"Unknown":     {in: d, keys: []string{"unknown"}, err: flat.ErrNotFound},
+			"Wrong type":  {in: d, keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Invalid":     {in: d, keys: []string{"oops"}, err: flat.ErrInvalidBase64},
+			"Missing pad": {in: d, keys: []string{"raw"}, err: flat.ErrInvalidBase64},
+			"Raw":         {in: d, keys: []string{"raw"}, raw: true, out: []byte("hi???")},
+			"OK":          {in: d, keys: []string{"std"}, out: []byte("hi???")},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			var (
+				out []byte
+				err error
+			)
+			if tt.raw {
+				out, err = tt.in.BytesRaw(tt.keys...)
+			} else {
+				out, err = tt.in.Bytes(tt.keys...)
+			}
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			are.Equal(tt.out, out)           // mismatch value
+		})
+	}
+}
+
+func TestD_Duration(t *testing.T) {
+	var (
+		d = flat.New(map[string]interface{}{
+			"string": "30s",
+			"number": json.Number("1000"),
+			"oops":   "30",
+		})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out     time.Duration
+			err     error
+			invalid bool
+		}{
+			"Default":   {err: flat.ErrNotFound},
+			"Blank":     {keys: []string{"string"}, err: flat.ErrNotFound},
+			"Unknown":   {in: d, err: flat.ErrNotFound, keys: []string{"unknown"}},
+			"Malformed": {in: d, invalid: true, keys: []string{"oops"}},
+			"Number":    {in: d, keys: []string{"number"}, out: time.Microsecond},
+			"OK":        {in: d, keys: []string{"string"}, out: 30 * time.Second},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.Duration(tt.keys...)
+			if tt.invalid {
+				are.True(err != nil) // expected error
+			} else {
+				are.True(errors.Is(err, tt.err)) // mismatch error
+			}
+			are.Equal(tt.out, out)                              // mismatch default value
+			are.Equal(tt.out, tt.in.ShouldDuration(tt.keys...)) // mismatch should value
+		})
+	}
+}
+
+func TestD_Bools(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"mixed":    []interface{}{float64(1), json.Number("2"), "3"},
+			"numbers":  []interface{}{json.Number("4"), json.Number("2")},
+			"booleans": []interface{}{true, "false"},
+			"strings":  []interface{}{nil, "4"},
+			"bool":     true,
+		})
+		dt = map[string]struct {
+			keys []string
+			out  []bool
+			err  error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Invalid":    {keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Wrong type": {keys: []string{"strings"}, err: flat.ErrOutOfRange},
+			"Mixed":      {keys: []string{"booleans"}, out: []bool{true, false}},
+			"Number":     {keys: []string{"numbers"}, err: flat.ErrOutOfRange},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.Bools(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_Float32(t *testing.T) {
+	var (
+		d   = flat.New(map[string]interface{}{"value": json.Number("3.14"), "large": json.Number("1e39")})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out float32
+			err error
+		}{
+			"Default":  {err: flat.ErrNotFound},
+			"Blank":    {keys: []string{"value"}, err: flat.ErrNotFound},
+			"Unknown":  {in: d, err: flat.ErrNotFound, keys: []string{"oops"}},
+			"Overflow": {in: d, err: flat.ErrOutOfRange, keys: []string{"large"}},
+			"OK":       {in: d, keys: []string{"value"}, out: 3.14},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.Float32(tt.keys...)
+			are.True(errors.Is(err, tt.err))                   // mismatch error
+			are.Equal(tt.out, out)                             // mismatch default value
+			are.Equal(tt.out, tt.in.ShouldFloat32(tt.keys...)) // mismatch should value
+		})
+	}
+}
+
 func TestD_Float64(t *testing.T) {
 	var (
 		f   = float64(3.14)
@@ -366,29 +3721,189 @@ func TestD_Float64(t *testing.T) {
 	}
 }
 
-func TestD_ShouldFloat64(t *testing.T) {
+func TestD_ShouldFloat64(t *testing.T) {
+	var (
+		f   = float64(3.14)
+		d   = flat.New(map[string]interface{}{"float64": f})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out float64
+		}{
+			"Default": {},
+			"Blank":   {keys: []string{"float64"}},
+			"Unknown": {in: d, keys: []string{"oops"}},
+			"OK":      {in: d, keys: []string{"float64"}, out: f},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := tt.in.ShouldFloat64(tt.keys...)
+			are.Equal(tt.out, out)
+		})
+	}
+}
+
+func TestD_Float64s(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"mixed":    []interface{}{float64(1), json.Number("2"), "3"},
+			"numbers":  []interface{}{json.Number("4"), json.Number("2")},
+			"booleans": []interface{}{true, "false"},
+			"strings":  []interface{}{nil, "4"},
+			"bool":     true,
+		})
+		dt = map[string]struct {
+			keys []string
+			out  []float64
+			err  error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Invalid":    {keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Wrong type": {keys: []string{"strings"}, err: flat.ErrOutOfRange},
+			"Mixed":      {keys: []string{"mixed"}, out: []float64{1, 2, 3}},
+			"Number":     {keys: []string{"numbers"}, out: []float64{4, 2}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.Float64s(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"bool":   true,
+			"number": json.Number("-42"),
+			"string": "Hello World",
+		})
+	)
+	t.Run("Default", func(t *testing.T) {
+		_, err := flat.Get[string](nil, "string")
+		are.True(errors.Is(err, flat.ErrNotFound)) // unexpected error
+	})
+	t.Run("Bool", func(t *testing.T) {
+		out, err := flat.Get[bool](d, "bool")
+		are.NoErr(err)       // unexpected error
+		are.Equal(true, out) // mismatch value
+	})
+	t.Run("Int64", func(t *testing.T) {
+		out, err := flat.Get[int64](d, "number")
+		are.NoErr(err)             // unexpected error
+		are.Equal(int64(-42), out) // mismatch value
+	})
+	t.Run("String", func(t *testing.T) {
+		out, err := flat.Get[string](d, "string")
+		are.NoErr(err)                // unexpected error
+		are.Equal("Hello World", out) // mismatch value
+	})
+	t.Run("Wrong type", func(t *testing.T) {
+		_, err := flat.Get[bool](d, "string")
+		are.True(errors.Is(err, strconv.ErrSyntax)) // unexpected error
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		out, err := flat.Get[[]byte](d, "string")
+		are.True(errors.Is(err, flat.ErrOutOfRange)) // unexpected error
+		are.Equal(nil, out)                          // unexpected value
+	})
+}
+
+func TestD_Int(t *testing.T) {
+	var (
+		f   = float64(-42)
+		d   = flat.New(map[string]interface{}{"int": f, "large": json.Number("92233720368547758070")})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out int
+			err error
+		}{
+			"Default":  {err: flat.ErrNotFound},
+			"Blank":    {keys: []string{"int"}, err: flat.ErrNotFound},
+			"Unknown":  {in: d, err: flat.ErrNotFound, keys: []string{"oops"}},
+			"Overflow": {in: d, err: flat.ErrOutOfRange, keys: []string{"large"}},
+			"OK":       {in: d, keys: []string{"int"}, out: -42},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.Int(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			are.Equal(tt.out, out)           // mismatch default value
+		})
+	}
+}
+
+func TestD_ShouldInt(t *testing.T) {
+	var (
+		f   = float64(-42)
+		d   = flat.New(map[string]interface{}{"int": f, "large": json.Number("92233720368547758070")})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out int
+		}{
+			"Default":  {},
+			"Blank":    {keys: []string{"int"}},
+			"Unknown":  {in: d, keys: []string{"oops"}},
+			"Overflow": {in: d, keys: []string{"large"}},
+			"OK":       {in: d, keys: []string{"int"}, out: -42},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out := tt.in.ShouldInt(tt.keys...)
+			are.Equal(tt.out, out)
+		})
+	}
+}
+
+func TestD_Int32(t *testing.T) {
 	var (
-		f   = float64(3.14)
-		d   = flat.New(map[string]interface{}{"float64": f})
+		d   = flat.New(map[string]interface{}{"value": float64(-42), "large": json.Number("2147483648")})
 		are = is.New(t)
 		dt  = map[string]struct {
 			// inputs
 			in   *flat.D
 			keys []string
 			// outputs
-			out float64
+			out int32
+			err error
 		}{
-			"Default": {},
-			"Blank":   {keys: []string{"float64"}},
-			"Unknown": {in: d, keys: []string{"oops"}},
-			"OK":      {in: d, keys: []string{"float64"}, out: f},
+			"Default":  {err: flat.ErrNotFound},
+			"Blank":    {keys: []string{"value"}, err: flat.ErrNotFound},
+			"Unknown":  {in: d, err: flat.ErrNotFound, keys: []string{"oops"}},
+			"Overflow": {in: d, err: flat.ErrOutOfRange, keys: []string{"large"}},
+			"OK":       {in: d, keys: []string{"value"}, out: -42},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			out := tt.in.ShouldFloat64(tt.keys...)
-			are.Equal(tt.out, out)
+			out, err := tt.in.Int32(tt.keys...)
+			are.True(errors.Is(err, tt.err))                 // mismatch error
+			are.Equal(tt.out, out)                           // mismatch default value
+			are.Equal(tt.out, tt.in.ShouldInt32(tt.keys...)) // mismatch should value
 		})
 	}
 }
@@ -449,6 +3964,158 @@ func TestD_ShouldInt64(t *testing.T) {
 	}
 }
 
+func TestD_Int64s(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"mixed":    []interface{}{float64(1), json.Number("2"), "3"},
+			"numbers":  []interface{}{json.Number("4"), json.Number("2")},
+			"booleans": []interface{}{true, "false"},
+			"strings":  []interface{}{nil, "4"},
+			"bool":     true,
+		})
+		dt = map[string]struct {
+			keys []string
+			out  []int64
+			err  error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Invalid":    {keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Wrong type": {keys: []string{"strings"}, err: flat.ErrOutOfRange},
+			"Mixed":      {keys: []string{"mixed"}, out: []int64{1, 2, 3}},
+			"Number":     {keys: []string{"numbers"}, out: []int64{4, 2}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.Int64s(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_Map(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"object": map[string]interface{}{"a": "b"},
+			"array":  []interface{}{"a"},
+			"string": "Hello World",
+		}, flat.XMLName("custom"))
+		dt = map[string]struct {
+			keys []string
+			out  string
+			err  error
+		}{
+			"Default": {err: flat.ErrNotFound},
+			"Unknown": {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Scalar":  {keys: []string{"string"}, err: flat.ErrOutOfRange},
+			"Array":   {keys: []string{"array"}, err: flat.ErrOutOfRange},
+			"OK":      {keys: []string{"object"}, out: "<custom><a>b</a></custom>"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.Map(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.err != nil {
+				are.Equal(nil, out) // unexpected data
+				return
+			}
+			are.Equal("b", out.ShouldString("a")) // mismatch data
+			b, err := xml.Marshal(out)
+			are.NoErr(err)               // unexpected encoding error
+			are.Equal(tt.out, string(b)) // mismatch settings
+		})
+	}
+}
+
+func TestD_Maps(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"objects": []interface{}{
+				map[string]interface{}{"a": "b"},
+				map[string]interface{}{"a": "c"},
+			},
+			"mixed":  []interface{}{map[string]interface{}{"a": "b"}, "c"},
+			"object": map[string]interface{}{"a": "b"},
+		}, flat.XMLName("custom"))
+		dt = map[string]struct {
+			keys []string
+			out  []string
+			err  error
+		}{
+			"Default": {err: flat.ErrNotFound},
+			"Unknown": {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Object":  {keys: []string{"object"}, err: flat.ErrOutOfRange},
+			"Scalar":  {keys: []string{"mixed"}, err: flat.ErrOutOfRange},
+			"OK":      {keys: []string{"objects"}, out: []string{"<custom><a>b</a></custom>", "<custom><a>c</a></custom>"}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.Maps(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(len(tt.out), len(out)) // mismatch length
+			for k, v := range out {
+				b, err := xml.Marshal(v)
+				are.NoErr(err)                  // unexpected encoding error
+				are.Equal(tt.out[k], string(b)) // mismatch data or settings
+			}
+		})
+	}
+}
+
+func TestD_GroupBy(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"type": "fruit", "name": "apple"},
+				map[string]interface{}{"type": "vegetable", "name": "leek"},
+				map[string]interface{}{"type": "fruit", "name": "pear"},
+			},
+			"mixed":   []interface{}{map[string]interface{}{"type": "fruit"}, "pear"},
+			"untyped": []interface{}{map[string]interface{}{"type": "fruit"}, map[string]interface{}{"name": "leek"}},
+		})
+		dt = map[string]struct {
+			keys []string
+			out  map[string][]string
+			err  error
+		}{
+			"Default":      {err: flat.ErrNotFound},
+			"Unknown":      {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Not objects":  {keys: []string{"mixed"}, err: flat.ErrOutOfRange},
+			"Missing type": {keys: []string{"untyped"}, err: flat.ErrNotFound},
+			"OK": {
+				keys: []string{"items"},
+				out:  map[string][]string{"fruit": {"apple", "pear"}, "vegetable": {"leek"}},
+			},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.GroupBy("type", tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(len(tt.out), len(out)) // mismatch groups
+			for k, a := range out {
+				names := make([]string, len(a))
+				for i, v := range a {
+					names[i] = v.ShouldString("name")
+				}
+				are.Equal(tt.out[k], names) // mismatch group
+			}
+		})
+	}
+}
+
 func TestD_String(t *testing.T) {
 	var (
 		s   = "hi"
@@ -480,6 +4147,44 @@ func TestD_String(t *testing.T) {
 	}
 }
 
+func TestD_StringAny(t *testing.T) {
+	var (
+		d = flat.New(map[string]interface{}{
+			"float":  1e21,
+			"small":  float32(0.5),
+			"bool":   true,
+			"number": json.Number("42"),
+			"null":   nil,
+			"array":  []interface{}{"a", float64(1)},
+			"object": map[string]interface{}{"a": "b"},
+		})
+		are = is.New(t)
+		dt  = map[string]struct {
+			keys []string
+			out  string
+			err  error
+		}{
+			"Default": {err: flat.ErrNotFound},
+			"Unknown": {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Object":  {keys: []string{"object"}, err: flat.ErrOutOfRange},
+			"Float":   {keys: []string{"float"}, out: "1000000000000000000000"},
+			"Float32": {keys: []string{"small"}, out: "0.5"},
+			"Bool":    {keys: []string{"bool"}, out: "true"},
+			"Number":  {keys: []string{"number"}, out: "42"},
+			"Null":    {keys: []string{"null"}},
+			"Array":   {keys: []string{"array"}, out: "a|1"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.StringAny(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // mismatch error
+			are.Equal(tt.out, out)           // mismatch value
+		})
+	}
+}
+
 func TestD_ShouldString(t *testing.T) {
 	var (
 		s   = "hi"
@@ -541,12 +4246,78 @@ func TestD_Strings(t *testing.T) {
 	}
 }
 
+func TestD_StringMatrix(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"matrix":  []interface{}{[]interface{}{"a", "b"}, []interface{}{json.Number("1"), "d"}},
+			"ragged":  []interface{}{[]interface{}{"a"}, []interface{}{}},
+			"flat":    []interface{}{"a", "b"},
+			"invalid": []interface{}{[]interface{}{"a"}, []interface{}{true}},
+			"string":  "a",
+		})
+		dt = map[string]struct {
+			keys []string
+			out  [][]string
+			err  error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Scalar":     {keys: []string{"string"}, err: flat.ErrOutOfRange},
+			"Flat":       {keys: []string{"flat"}, err: flat.ErrOutOfRange},
+			"Wrong type": {keys: []string{"invalid"}, err: flat.ErrOutOfRange},
+			"Ragged":     {keys: []string{"ragged"}, out: [][]string{{"a"}, {}}},
+			"OK":         {keys: []string{"matrix"}, out: [][]string{{"a", "b"}, {"1", "d"}}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.StringMatrix(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_StringsJoin(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"booleans": []interface{}{true},
+			"strings":  []interface{}{"4", json.Number("2")},
+		})
+		dt = map[string]struct {
+			sep  string
+			keys []string
+			out  string
+			err  error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Wrong type": {keys: []string{"booleans"}, err: flat.ErrOutOfRange},
+			"Blank sep":  {keys: []string{"strings"}, out: "4|2"},
+			"OK":         {sep: ", ", keys: []string{"strings"}, out: "4, 2"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.StringsJoin(tt.sep, tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
 func TestD_Time(t *testing.T) {
 	var (
 		are = is.New(t)
 		d   = flat.New(map[string]interface{}{
 			"time": "08/1983",
 			"bool": true,
+			"rfc":  "2021-05-04T03:02:01Z",
+			"nano": "2021-05-04T03:02:01.123456789+02:00",
 		})
 		x  = time.Date(1983, time.August, 1, 0, 0, 0, 0, time.UTC)
 		dt = map[string]struct {
@@ -554,20 +4325,62 @@ func TestD_Time(t *testing.T) {
 			keys   []string
 			out    time.Time
 			err    error
+			parse  bool
 		}{
 			"Default":    {err: flat.ErrNotFound},
 			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
 			"Wrong type": {keys: []string{"bool"}, err: flat.ErrOutOfRange},
-			"OK":         {keys: []string{"time"}, layout: "01/2006", out: x},
+			"Mismatch":   {keys: []string{"time"}, parse: true},
+			"RFC 3339":   {keys: []string{"rfc"}, out: time.Date(2021, time.May, 4, 3, 2, 1, 0, time.UTC)},
+			"Nano": {
+				keys: []string{"nano"},
+				out:  time.Date(2021, time.May, 4, 3, 2, 1, 123456789, time.FixedZone("", 2*60*60)),
+			},
+			"OK": {keys: []string{"time"}, layout: "01/2006", out: x},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
 			out, err := d.Time(tt.layout, tt.keys...)
-			are.True(errors.Is(err, tt.err))                       // unexpected error
-			are.Equal(tt.out, out)                                 // mismatch data
-			are.Equal(tt.out, d.ShouldTime(tt.layout, tt.keys...)) // mismatch should data
+			if tt.parse {
+				var e *time.ParseError
+				are.True(errors.As(err, &e)) // expected parse error
+			} else {
+				are.True(errors.Is(err, tt.err)) // unexpected error
+			}
+			are.True(tt.out.Equal(out))                                 // mismatch data
+			are.True(tt.out.Equal(d.ShouldTime(tt.layout, tt.keys...))) // mismatch should data
+		})
+	}
+}
+
+func TestD_Uint32(t *testing.T) {
+	var (
+		d   = flat.New(map[string]interface{}{"value": float64(42), "large": json.Number("4294967296")})
+		are = is.New(t)
+		dt  = map[string]struct {
+			// inputs
+			in   *flat.D
+			keys []string
+			// outputs
+			out uint32
+			err error
+		}{
+			"Default":  {err: flat.ErrNotFound},
+			"Blank":    {keys: []string{"value"}, err: flat.ErrNotFound},
+			"Unknown":  {in: d, err: flat.ErrNotFound, keys: []string{"oops"}},
+			"Overflow": {in: d, err: flat.ErrOutOfRange, keys: []string{"large"}},
+			"OK":       {in: d, keys: []string{"value"}, out: 42},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := tt.in.Uint32(tt.keys...)
+			are.True(errors.Is(err, tt.err))                  // mismatch error
+			are.Equal(tt.out, out)                            // mismatch default value
+			are.Equal(tt.out, tt.in.ShouldUint32(tt.keys...)) // mismatch should value
 		})
 	}
 }
@@ -627,3 +4440,187 @@ func TestD_ShouldUint64(t *testing.T) {
 		})
 	}
 }
+
+func TestD_Uint64s(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"mixed":    []interface{}{float64(1), json.Number("2"), "3"},
+			"numbers":  []interface{}{json.Number("4"), json.Number("2")},
+			"booleans": []interface{}{true, "false"},
+			"strings":  []interface{}{nil, "4"},
+			"bool":     true,
+		})
+		dt = map[string]struct {
+			keys []string
+			out  []uint64
+			err  error
+		}{
+			"Default":    {err: flat.ErrNotFound},
+			"Unknown":    {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Invalid":    {keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Wrong type": {keys: []string{"strings"}, err: flat.ErrOutOfRange},
+			"Mixed":      {keys: []string{"mixed"}, out: []uint64{1, 2, 3}},
+			"Number":     {keys: []string{"numbers"}, out: []uint64{4, 2}},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.Uint64s(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_UnixMilliTime(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"number": json.Number("428544000500"),
+			"float":  float64(428544000500),
+			"string": "428544000500",
+			"bool":   true,
+			"text":   "abc",
+		})
+		x  = time.Date(1983, time.August, 1, 0, 0, 0, int(500*time.Millisecond), time.UTC)
+		dt = map[string]struct {
+			keys []string
+			out  time.Time
+			err  error
+		}{
+			"Default":     {err: flat.ErrNotFound},
+			"Unknown":     {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Wrong type":  {keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Not numeric": {keys: []string{"text"}, err: flat.ErrOutOfRange},
+			"Float":       {keys: []string{"float"}, out: x},
+			"String":      {keys: []string{"string"}, out: x},
+			"OK":          {keys: []string{"number"}, out: x},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.UnixMilliTime(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func TestD_UnixTime(t *testing.T) {
+	var (
+		are = is.New(t)
+		d   = flat.New(map[string]interface{}{
+			"number": json.Number("428544000"),
+			"float":  float64(428544000),
+			"string": "428544000",
+			"bool":   true,
+			"text":   "abc",
+		})
+		x  = time.Date(1983, time.August, 1, 0, 0, 0, 0, time.UTC)
+		dt = map[string]struct {
+			keys []string
+			out  time.Time
+			err  error
+		}{
+			"Default":     {err: flat.ErrNotFound},
+			"Unknown":     {keys: []string{"oops"}, err: flat.ErrNotFound},
+			"Wrong type":  {keys: []string{"bool"}, err: flat.ErrOutOfRange},
+			"Not numeric": {keys: []string{"text"}, err: flat.ErrOutOfRange},
+			"Float":       {keys: []string{"float"}, out: x},
+			"String":      {keys: []string{"string"}, out: x},
+			"OK":          {keys: []string{"number"}, out: x},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := d.UnixTime(tt.keys...)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch data
+		})
+	}
+}
+
+func BenchmarkFlatten(b *testing.B) {
+	const n = 100
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		o := make(map[string]interface{}, n)
+		for j := 0; j < n; j++ {
+			o["leaf"+strconv.Itoa(j)] = float64(j)
+		}
+		m["node"+strconv.Itoa(i)] = map[string]interface{}{"child": o}
+	}
+	d := flat.New(m)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = d.Flatten()
+	}
+}
+
+func BenchmarkXMLEncode(b *testing.B) {
+	const n = 30
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		o := make(map[string]interface{}, n)
+		for j := 0; j < n; j++ {
+			o["leaf"+strconv.Itoa(j)] = "value <" + strconv.Itoa(j) + ">"
+		}
+		m["node"+strconv.Itoa(i)] = o
+	}
+	var (
+		d   = flat.New(m)
+		buf bytes.Buffer
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		_ = d.XMLEncode(&buf)
+	}
+}
+
+func BenchmarkInternStrings(b *testing.B) {
+	const n = 1000
+	var buf bytes.Buffer
+	buf.WriteString(`<d>`)
+	for i := 0; i < n; i++ {
+		buf.WriteString(`<item><status>ACCOUNT_STATUS_ACTIVE</status><country>FRANCE_METROPOLITAN</country></item>`)
+	}
+	buf.WriteString(`</d>`)
+	data := buf.Bytes()
+	for name, opts := range map[string][]flat.Settings{
+		"Default":  nil,
+		"Interned": {flat.InternStrings()},
+	} {
+		opts := opts
+		b.Run(name, func(b *testing.B) {
+			var (
+				ms       runtime.MemStats
+				retained int64
+			)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				d := flat.New(nil, append(opts, flat.XMLArrayElement("item"))...)
+				b.StopTimer()
+				runtime.GC()
+				runtime.ReadMemStats(&ms)
+				before := int64(ms.HeapAlloc)
+				b.StartTimer()
+				_ = xml.Unmarshal(data, d)
+				b.StopTimer()
+				// Measures the memory still used by the data once decoded.
+				runtime.GC()
+				runtime.ReadMemStats(&ms)
+				retained += int64(ms.HeapAlloc) - before
+				runtime.KeepAlive(d)
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
@@ -14,10 +14,34 @@ func (s errFlat) Error() string {
 }
 
 const (
+	// ErrConflict is returned when a key is present in several data to merge.
+	ErrConflict = errFlat("conflicting key")
+	// ErrCycle is returned when the data contains a reference to itself.
+	ErrCycle = errFlat("cyclic reference")
+	// ErrLimitExceeded is returned when the data exceeds the limits defined by MaxDepth or MaxKeys.
+	ErrLimitExceeded = errFlat("limit exceeded")
+	// ErrMissingRequired is returned when a required key is missing.
+	ErrMissingRequired = errFlat("missing required key")
 	// ErrNotFound is returned when the key is unknown.
 	ErrNotFound = errFlat("not found")
+	// ErrInvalidPatch is returned when a JSON patch does not respect the RFC 6902.
+	ErrInvalidPatch = errFlat("invalid JSON patch")
+	// ErrInvalidPointer is returned when a JSON pointer does not respect the RFC 6901.
+	ErrInvalidPointer = errFlat("invalid JSON pointer")
+	// ErrInvalidTarget is returned when the destination of the data is not a non-nil pointer.
+	ErrInvalidTarget = errFlat("invalid target")
+	// ErrInvalidBase64 is returned when the data can not be decoded as base64.
+	ErrInvalidBase64 = errFlat("invalid base64 data")
 	// ErrOutOfRange is returned when the type of data requested does not correspond to that of the data.
 	ErrOutOfRange = errFlat("wrong data type")
+	// ErrTestFailed is returned when the value tested by a JSON patch differs.
+	ErrTestFailed = errFlat("test operation failed")
+	// ErrTrailingData is returned when data remains after the end of the JSON value.
+	ErrTrailingData = errFlat("trailing data")
+	// ErrUnknownFormat is returned when the data format is not supported.
+	ErrUnknownFormat = errFlat("unknown format")
+	// ErrUnknownKey is returned when a key is not part of the allowed ones.
+	ErrUnknownKey = errFlat("unknown key")
 )
 
 func newErrOutOfRange(exp, got interface{}) error {
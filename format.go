@@ -5,38 +5,192 @@
 package flat
 
 import (
+	"encoding"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	base10    = 10
-	bits64    = 64
-	precision = -1
+	base10      = 10
+	bits32      = 32
+	bits64      = 64
+	precision   = -1
+	msPerSecond = int64(time.Second / time.Millisecond)
 )
 
-func fmtString(x interface{}, xmlArraySep string) string {
+func fmtString(x interface{}, xmlArraySep, timeLayout string) string {
 	switch d := x.(type) {
 	case []interface{}:
 		a := make([]string, len(d))
 		for k, v := range d {
-			a[k] = fmtString(v, xmlArraySep)
+			a[k] = fmtString(v, xmlArraySep, timeLayout)
 		}
 		return strings.Join(a, xmlArraySep)
 	case bool:
 		return strconv.FormatBool(d)
+	case float32:
+		return strconv.FormatFloat(float64(d), 'g', precision, bits32)
 	case float64:
 		return strconv.FormatFloat(d, 'g', precision, bits64)
+	case int:
+		return strconv.FormatInt(int64(d), base10)
+	case int8:
+		return strconv.FormatInt(int64(d), base10)
+	case int16:
+		return strconv.FormatInt(int64(d), base10)
+	case int32:
+		return strconv.FormatInt(int64(d), base10)
+	case int64:
+		return strconv.FormatInt(d, base10)
+	case uint:
+		return strconv.FormatUint(uint64(d), base10)
+	case uint8:
+		return strconv.FormatUint(uint64(d), base10)
+	case uint16:
+		return strconv.FormatUint(uint64(d), base10)
+	case uint32:
+		return strconv.FormatUint(uint64(d), base10)
+	case uint64:
+		return strconv.FormatUint(d, base10)
 	case string:
 		return d
+	case CDATA:
+		return string(d)
 	case json.Number:
 		return d.String()
+	case time.Time:
+		return d.Format(timeLayout)
+	case encoding.TextMarshaler:
+		b, err := d.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(b)
 	default:
 		return ""
 	}
 }
 
+// inferType returns the value behind the string s as a bool, a json.Number or nil if blank.
+// Otherwise, the string is returned as it is.
+func inferType(s string) interface{} {
+	switch {
+	case strings.TrimSpace(s) == "":
+		return nil
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case isNumber(s):
+		return json.Number(s)
+	default:
+		return s
+	}
+}
+
+// isNumber returns true if the string s is a number as defined by the JSON specification.
+func isNumber(s string) bool {
+	n := len(s)
+	if n == 0 {
+		return false
+	}
+	isDigit := func(c byte) bool {
+		return c >= '0' && c <= '9'
+	}
+	if (s[0] != '-' && !isDigit(s[0])) || !isDigit(s[n-1]) {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+// toNumber returns the exact value of any number, whatever its Go type, as a big.Rat.
+// Floating-point numbers are taken as their shortest decimal representation,
+// so the same decimal has the same value however it is written.
+// The boolean is false if the value is not a number.
+func toNumber(m interface{}) (*big.Rat, bool) {
+	switch m.(type) {
+	case json.Number, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return new(big.Rat).SetString(fmtString(m, "", DefaultTimeLayout))
+	default:
+		return nil, false
+	}
+}
+
+func toBigFloat(m interface{}) (*big.Float, error) {
+	switch v := m.(type) {
+	case float64:
+		if math.IsNaN(v) {
+			var x *big.Float
+			return x, newErrOutOfRange(x, v)
+		}
+		return big.NewFloat(v), nil
+	case int64:
+		return new(big.Float).SetInt64(v), nil
+	case json.Number:
+		return parseBigFloat(v.String())
+	case string:
+		return parseBigFloat(v)
+	default:
+		var x *big.Float
+		return x, newErrOutOfRange(x, v)
+	}
+}
+
+// bitsPerDigit is used to size the precision of a big.Float large enough to hold all the given digits.
+const bitsPerDigit = 4
+
+func parseBigFloat(s string) (*big.Float, error) {
+	prec := uint(len(s)) * bitsPerDigit
+	if prec < bits64 {
+		prec = bits64
+	}
+	f, _, err := big.ParseFloat(s, base10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, s)
+	}
+	return f, nil
+}
+
+func toBigInt(m interface{}) (*big.Int, error) {
+	switch v := m.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			var x *big.Int
+			return x, newErrOutOfRange(x, v)
+		}
+		f := big.NewFloat(v)
+		if !f.IsInt() {
+			var x *big.Int
+			return x, newErrOutOfRange(x, v)
+		}
+		i, _ := f.Int(nil)
+		return i, nil
+	case int64:
+		return big.NewInt(v), nil
+	case json.Number:
+		return parseBigInt(v.String())
+	case string:
+		return parseBigInt(v)
+	default:
+		var x *big.Int
+		return x, newErrOutOfRange(x, v)
+	}
+}
+
+func parseBigInt(s string) (*big.Int, error) {
+	i, ok := new(big.Int).SetString(s, base10)
+	if !ok {
+		return nil, &strconv.NumError{Func: "ParseInt", Num: s, Err: strconv.ErrSyntax}
+	}
+	return i, nil
+}
+
 func toBool(m interface{}) (bool, error) {
 	switch v := m.(type) {
 	case bool:
@@ -49,10 +203,41 @@ func toBool(m interface{}) (bool, error) {
 	}
 }
 
+func toDuration(m interface{}) (time.Duration, error) {
+	switch v := m.(type) {
+	case float64:
+		return time.Duration(v), nil
+	case int64:
+		return time.Duration(v), nil
+	case json.Number:
+		i, err := v.Int64()
+		return time.Duration(i), err
+	case string:
+		return time.ParseDuration(v)
+	default:
+		var x time.Duration
+		return x, newErrOutOfRange(x, v)
+	}
+}
+
+func toFloat32(m interface{}) (float32, error) {
+	f, err := toFloat64(m)
+	if errors.Is(err, strconv.ErrRange) || (!math.IsInf(f, 0) && math.Abs(f) > math.MaxFloat32) {
+		var x float32
+		return x, newErrOutOfRange(x, m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return float32(f), nil
+}
+
 func toFloat64(m interface{}) (float64, error) {
 	switch v := m.(type) {
 	case float64:
 		return v, nil
+	case int64:
+		return float64(v), nil
 	case json.Number:
 		return v.Float64()
 	case string:
@@ -63,40 +248,96 @@ func toFloat64(m interface{}) (float64, error) {
 	}
 }
 
-func toInt64(m interface{}) (int64, error) {
+func toInt(m interface{}, base int) (int, error) {
+	i, err := toInt64(m, base)
+	if errors.Is(err, strconv.ErrRange) || int64(int(i)) != i {
+		var x int
+		return x, newErrOutOfRange(x, m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(i), nil
+}
+
+func toInt32(m interface{}, base int) (int32, error) {
+	i, err := toInt64(m, base)
+	if errors.Is(err, strconv.ErrRange) || i < math.MinInt32 || i > math.MaxInt32 {
+		var x int32
+		return x, newErrOutOfRange(x, m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int32(i), nil
+}
+
+func toInt64(m interface{}, base int) (int64, error) {
 	switch v := m.(type) {
 	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			var x int64
+			return x, newErrOutOfRange(x, v)
+		}
 		return int64(v), nil
+	case int64:
+		return v, nil
 	case json.Number:
 		return v.Int64()
 	case string:
-		return strconv.ParseInt(v, base10, bits64)
+		return strconv.ParseInt(v, base, bits64)
 	default:
 		var x int64
 		return x, newErrOutOfRange(x, v)
 	}
 }
 
-func toString(m interface{}) (string, error) {
+func toString(m interface{}, timeLayout string) (string, error) {
 	switch v := m.(type) {
+	case time.Time:
+		return v.Format(timeLayout), nil
 	case json.Number:
 		return v.String(), nil
 	case string:
 		return v, nil
+	case CDATA:
+		return string(v), nil
 	default:
 		var x string
 		return x, newErrOutOfRange(x, v)
 	}
 }
 
-func toUint64(m interface{}) (uint64, error) {
+func toUint32(m interface{}, base int) (uint32, error) {
+	i, err := toUint64(m, base)
+	if errors.Is(err, strconv.ErrRange) || i > math.MaxUint32 {
+		var x uint32
+		return x, newErrOutOfRange(x, m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint32(i), nil
+}
+
+func toUint64(m interface{}, base int) (uint64, error) {
 	switch v := m.(type) {
 	case float64:
+		if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+			var x uint64
+			return x, newErrOutOfRange(x, v)
+		}
+		return uint64(v), nil
+	case int64:
+		if v < 0 {
+			var x uint64
+			return x, newErrOutOfRange(x, v)
+		}
 		return uint64(v), nil
 	case json.Number:
 		return strconv.ParseUint(v.String(), base10, bits64)
 	case string:
-		return strconv.ParseUint(v, base10, bits64)
+		return strconv.ParseUint(v, base, bits64)
 	default:
 		var x uint64
 		return x, newErrOutOfRange(x, v)
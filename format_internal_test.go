@@ -7,12 +7,23 @@ package flat
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
 
+type text string
+
+func (s text) MarshalText() ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty")
+	}
+	return []byte("text:" + s), nil
+}
+
 func TestFmtString(t *testing.T) {
 	var (
 		are = is.New(t)
@@ -27,21 +38,150 @@ func TestFmtString(t *testing.T) {
 			"False":         {in: false, out: "false"},
 			"True":          {in: true, out: "true"},
 			"String":        {in: "string", out: "string"},
+			"CDATA":         {in: CDATA("<b>"), out: "<b>"},
 			"Pi":            {in: float64(3.14), out: "3.14"},
 			"JSON number":   {in: json.Number("-42"), out: "-42"},
-			"Not supported": {in: int64(-42), out: ""},
+			"Int":           {in: int(42), out: "42"},
+			"Int64":         {in: int64(-42), out: "-42"},
+			"Uint64":        {in: uint64(42), out: "42"},
+			"Float32":       {in: float32(3.14), out: "3.14"},
+			"Not supported": {in: struct{}{}, out: ""},
+			"Text":          {in: text("id"), out: "text:id"},
+			"Time":          {in: time.Date(2021, 9, 18, 11, 30, 0, 5, time.UTC), out: "2021-09-18T11:30:00Z"},
+			"Text error":    {in: text(""), out: ""},
 			"Slice":         {in: []interface{}{"4", "2"}, sep: DefaultXMLArraySep, out: "4|2"},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			out := fmtString(tt.in, tt.sep)
+			out := fmtString(tt.in, tt.sep, DefaultTimeLayout)
 			are.Equal(tt.out, out)
 		})
 	}
 }
 
+func TestInferType(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  string
+			out interface{}
+		}{
+			"Default":      {},
+			"Blank":        {in: "\n  "},
+			"False":        {in: "false", out: false},
+			"True":         {in: "true", out: true},
+			"Title":        {in: "True", out: "True"},
+			"Integer":      {in: "-42", out: json.Number("-42")},
+			"Float":        {in: "3.14e2", out: json.Number("3.14e2")},
+			"Leading zero": {in: "0042", out: "0042"},
+			"Spaces":       {in: " 42 ", out: " 42 "},
+			"Hexadecimal":  {in: "0x1F", out: "0x1F"},
+			"String":       {in: "Hello World", out: "Hello World"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			are.Equal(tt.out, inferType(tt.in)) // mismatch result
+		})
+	}
+}
+
+func TestToNumber(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out string
+			ok  bool
+		}{
+			"Default":        {},
+			"String":         {in: "42"},
+			"Int":            {in: 42, out: "42", ok: true},
+			"Float":          {in: float64(0.1), out: "1/10", ok: true},
+			"Number":         {in: json.Number("0.1"), out: "1/10", ok: true},
+			"Trailing zeros": {in: json.Number("0.300000000000000000"), out: "3/10", ok: true},
+			"Invalid":        {in: json.Number("oops")},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, ok := toNumber(tt.in)
+			are.Equal(tt.ok, ok) // mismatch status
+			if ok {
+				are.Equal(tt.out, out.RatString()) // mismatch result
+			}
+		})
+	}
+}
+
+func TestToBigFloat(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in      interface{}
+			out     string
+			err     error
+			invalid bool
+		}{
+			"Default": {err: ErrOutOfRange},
+			"Invalid": {in: "oops", invalid: true},
+			"NaN":     {in: math.NaN(), err: ErrOutOfRange},
+			"Inf":     {in: math.Inf(1), out: "+Inf"},
+			"Float":   {in: float64(3.14), out: "3.14"},
+			"Number":  {in: json.Number("123456789012345678901234567890.5"), out: "123456789012345678901234567890.5"},
+			"OK":      {in: "3.14", out: "3.14"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toBigFloat(tt.in)
+			if tt.invalid {
+				are.True(err != nil) // expected error
+				return
+			}
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.err == nil {
+				are.Equal(tt.out, out.Text('f', -1)) // mismatch result
+			}
+		})
+	}
+}
+
+func TestToBigInt(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out string
+			err error
+		}{
+			"Default":  {err: ErrOutOfRange},
+			"Invalid":  {in: "3.14", err: strconv.ErrSyntax},
+			"Fraction": {in: float64(3.14), err: ErrOutOfRange},
+			"NaN":      {in: math.NaN(), err: ErrOutOfRange},
+			"Inf":      {in: math.Inf(-1), err: ErrOutOfRange},
+			"Float":    {in: float64(-42), out: "-42"},
+			"Number":   {in: json.Number("123456789012345678901234567890"), out: "123456789012345678901234567890"},
+			"OK":       {in: "-42", out: "-42"},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toBigInt(tt.in)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			if tt.err == nil {
+				are.Equal(tt.out, out.String()) // mismatch result
+			}
+		})
+	}
+}
+
 func TestToBool(t *testing.T) {
 	var (
 		are = is.New(t)
@@ -66,6 +206,61 @@ func TestToBool(t *testing.T) {
 	}
 }
 
+func TestToDuration(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in      interface{}
+			out     time.Duration
+			err     error
+			invalid bool
+		}{
+			"Default": {err: ErrOutOfRange},
+			"Invalid": {in: "30", out: 0, invalid: true},
+			"Float":   {in: float64(1000), out: time.Microsecond},
+			"Number":  {in: json.Number("1000"), out: time.Microsecond},
+			"OK":      {in: "1h30m", out: 90 * time.Minute},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toDuration(tt.in)
+			if tt.invalid {
+				are.True(err != nil) // expected error
+				return
+			}
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch result
+		})
+	}
+}
+
+func TestToFloat32(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out float32
+			err error
+		}{
+			"Default":  {err: ErrOutOfRange},
+			"Invalid":  {in: "", out: 0, err: strconv.ErrSyntax},
+			"Overflow": {in: float64(math.MaxFloat64), err: ErrOutOfRange},
+			"Number":   {in: json.Number("3.14"), out: 3.14},
+			"OK":       {in: float64(3.14), out: 3.14},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toFloat32(tt.in)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch result
+		})
+	}
+}
+
 func TestToFloat64(t *testing.T) {
 	var (
 		are = is.New(t)
@@ -78,6 +273,7 @@ func TestToFloat64(t *testing.T) {
 			"Invalid": {in: "", out: 0, err: strconv.ErrSyntax},
 			"Number":  {in: json.Number("3.14"), out: 3.14},
 			"String":  {in: "3.14", out: 3.14},
+			"Integer": {in: int64(3), out: 3},
 			"OK":      {in: float64(3.14), out: 3.14},
 		}
 	)
@@ -91,6 +287,58 @@ func TestToFloat64(t *testing.T) {
 	}
 }
 
+func TestToInt(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out int
+			err error
+		}{
+			"Default":  {err: ErrOutOfRange},
+			"Invalid":  {in: "", out: 0, err: strconv.ErrSyntax},
+			"Overflow": {in: json.Number("92233720368547758070"), out: 0, err: ErrOutOfRange},
+			"Number":   {in: json.Number("-42"), out: -42},
+			"String":   {in: "-42", out: -42},
+			"OK":       {in: float64(-42), out: -42},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toInt(tt.in, base10)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch result
+		})
+	}
+}
+
+func TestToInt32(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out int32
+			err error
+		}{
+			"Default":   {err: ErrOutOfRange},
+			"Invalid":   {in: "", out: 0, err: strconv.ErrSyntax},
+			"Overflow":  {in: json.Number("2147483648"), err: ErrOutOfRange},
+			"Underflow": {in: float64(-2147483649), err: ErrOutOfRange},
+			"Number":    {in: json.Number("-2147483648"), out: math.MinInt32},
+			"OK":        {in: float64(-42), out: -42},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toInt32(tt.in, base10)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch result
+		})
+	}
+}
+
 func TestToInt64(t *testing.T) {
 	var (
 		are = is.New(t)
@@ -99,17 +347,20 @@ func TestToInt64(t *testing.T) {
 			out int64
 			err error
 		}{
-			"Default": {err: ErrOutOfRange},
-			"Invalid": {in: "", out: 0, err: strconv.ErrSyntax},
-			"Number":  {in: json.Number("-42"), out: -42},
-			"String":  {in: "-42", out: -42},
-			"OK":      {in: float64(-42), out: -42},
+			"Default":  {err: ErrOutOfRange},
+			"Invalid":  {in: "", out: 0, err: strconv.ErrSyntax},
+			"Number":   {in: json.Number("-42"), out: -42},
+			"String":   {in: "-42", out: -42},
+			"Fraction": {in: float64(3.9), err: ErrOutOfRange},
+			"Exact":    {in: float64(3.0), out: 3},
+			"Integer":  {in: int64(-42), out: -42},
+			"OK":       {in: float64(-42), out: -42},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			out, err := toInt64(tt.in)
+			out, err := toInt64(tt.in, base10)
 			are.True(errors.Is(err, tt.err)) // unexpected error
 			are.Equal(tt.out, out)           // mismatch result
 		})
@@ -127,13 +378,40 @@ func TestToString(t *testing.T) {
 			"Default": {err: ErrOutOfRange},
 			"Bool":    {in: true, out: "", err: ErrOutOfRange},
 			"Number":  {in: json.Number("-42"), out: "-42"},
+			"CDATA":   {in: CDATA("oops"), out: "oops"},
+			"Time":    {in: time.Date(2021, 9, 18, 11, 30, 0, 0, time.UTC), out: "2021-09-18T11:30:00Z"},
 			"OK":      {in: "oops", out: "oops"},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			out, err := toString(tt.in)
+			out, err := toString(tt.in, DefaultTimeLayout)
+			are.True(errors.Is(err, tt.err)) // unexpected error
+			are.Equal(tt.out, out)           // mismatch result
+		})
+	}
+}
+
+func TestToUint32(t *testing.T) {
+	var (
+		are = is.New(t)
+		dt  = map[string]struct {
+			in  interface{}
+			out uint32
+			err error
+		}{
+			"Default":  {err: ErrOutOfRange},
+			"Invalid":  {in: "", out: 0, err: strconv.ErrSyntax},
+			"Overflow": {in: json.Number("4294967296"), err: ErrOutOfRange},
+			"Number":   {in: json.Number("4294967295"), out: math.MaxUint32},
+			"OK":       {in: float64(42), out: 42},
+		}
+	)
+	for name, tt := range dt {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, err := toUint32(tt.in, base10)
 			are.True(errors.Is(err, tt.err)) // unexpected error
 			are.Equal(tt.out, out)           // mismatch result
 		})
@@ -148,17 +426,22 @@ func TestToUint64(t *testing.T) {
 			out uint64
 			err error
 		}{
-			"Default": {err: ErrOutOfRange},
-			"Invalid": {in: "", out: 0, err: strconv.ErrSyntax},
-			"Number":  {in: json.Number("42"), out: 42},
-			"String":  {in: "42", out: 42},
-			"OK":      {in: float64(42), out: 42},
+			"Default":          {err: ErrOutOfRange},
+			"Invalid":          {in: "", out: 0, err: strconv.ErrSyntax},
+			"Number":           {in: json.Number("42"), out: 42},
+			"String":           {in: "42", out: 42},
+			"Fraction":         {in: float64(3.9), err: ErrOutOfRange},
+			"Negative":         {in: float64(-1.0), err: ErrOutOfRange},
+			"Exact":            {in: float64(3.0), out: 3},
+			"Integer":          {in: int64(42), out: 42},
+			"Negative integer": {in: int64(-1), err: ErrOutOfRange},
+			"OK":               {in: float64(42), out: 42},
 		}
 	)
 	for name, tt := range dt {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			out, err := toUint64(tt.in)
+			out, err := toUint64(tt.in, base10)
 			are.True(errors.Is(err, tt.err)) // unexpected error
 			are.Equal(tt.out, out)           // mismatch result
 		})
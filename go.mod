@@ -1,6 +1,6 @@
 module github.com/rvflash/flat
 
-go 1.16
+go 1.18
 
 require (
 	github.com/google/go-cmp v0.5.9